@@ -0,0 +1,421 @@
+// Package cassette records the probe responses of a scan and replays them,
+// so detections can be re-evaluated offline after signatures change, and
+// the exact traffic behind a detection can be shared.
+//
+// A cassette directory holds one JSON file per target with the request,
+// status, headers, body, TLS details and timing of every probe. Bodies longer than the
+// recorder's limit are truncated.
+//
+//	rec, err := cassette.NewRecorder("scans/2025-12-31", cassette.DefaultMaxBody)
+//	client, err := wafdetector.New(wafdetector.WithRecorder(rec))
+//	...
+//	player, err := cassette.NewPlayer("scans/2025-12-31")
+//	client, err := wafdetector.New(wafdetector.WithProber(player))
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	waferrors "github.com/ahmedtouahria/waf-detector/errors"
+	"github.com/ahmedtouahria/waf-detector/scanner"
+)
+
+// formatVersion is bumped when the cassette layout changes
+const formatVersion = 1
+
+// DefaultMaxBody is how many bytes of each body are recorded by default
+const DefaultMaxBody = 64 * 1024
+
+// ErrNotRecorded is returned when replaying a target with no cassette
+var ErrNotRecorded = errors.New("target was not recorded")
+
+// Cassette holds the probe results of one target. Target comes first so
+// that it can be read without decoding the bodies.
+type Cassette struct {
+	Target     string           `json:"target"`
+	Version    int              `json:"version"`
+	RecordedAt time.Time        `json:"recorded_at"`
+	Probes     map[string]Probe `json:"probes"`
+}
+
+// Probe is a recorded scanner.ProbeResult
+type Probe struct {
+	Request    *Request    `json:"request,omitempty"`
+	URL        string      `json:"url,omitempty"`
+	Status     int         `json:"status,omitempty"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyLength int         `json:"body_length"`
+	Truncated  bool        `json:"truncated,omitempty"`
+	Samples    []string    `json:"samples,omitempty"`
+	TLS        *TLS        `json:"tls,omitempty"`
+	Duration   string      `json:"duration"`
+	Error      string      `json:"error,omitempty"`
+	// ErrorType is the classification of Error; cassettes recorded before
+	// it was added replay their errors unclassified
+	ErrorType string `json:"error_type,omitempty"`
+}
+
+// TLS is a recorded scanner.TLSInfo
+type TLS struct {
+	Version     string   `json:"version"`
+	CipherSuite string   `json:"cipher_suite"`
+	ALPN        string   `json:"alpn,omitempty"`
+	Issuer      string   `json:"issuer,omitempty"`
+	Subject     string   `json:"subject,omitempty"`
+	SANs        []string `json:"sans,omitempty"`
+}
+
+// Request is a recorded scanner.ProbeRequest
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// New records probes for target, truncating bodies to maxBody bytes. A
+// maxBody of 0 or less keeps whole bodies.
+func New(target string, probes map[scanner.ProbeType]*scanner.ProbeResult, maxBody int) Cassette {
+	c := Cassette{
+		Target:     target,
+		Version:    formatVersion,
+		RecordedAt: time.Now().UTC(),
+		Probes:     make(map[string]Probe, len(probes)),
+	}
+
+	for probeType, result := range probes {
+		if result == nil {
+			continue
+		}
+		body, truncated := truncate(result.Body, maxBody)
+		probe := Probe{
+			URL:        result.URL,
+			Status:     result.StatusCode,
+			Headers:    result.Headers,
+			Body:       body,
+			BodyLength: result.BodyLength,
+			Truncated:  truncated,
+			Duration:   result.Duration.String(),
+		}
+		for _, sample := range result.Samples {
+			sample, _ = truncate(sample, maxBody)
+			probe.Samples = append(probe.Samples, sample)
+		}
+		if result.Error != nil {
+			probe.Error = result.Error.Error()
+			probe.ErrorType = string(waferrors.TypeOf(result.Error))
+		}
+		if req := result.Request; req != nil {
+			probe.Request = &Request{
+				Method:  req.Method,
+				URL:     req.URL,
+				Headers: req.Headers,
+				Body:    req.Body,
+			}
+		}
+		if info := result.TLS; info != nil {
+			probe.TLS = &TLS{
+				Version:     info.Version,
+				CipherSuite: info.CipherSuite,
+				ALPN:        info.ALPN,
+				Issuer:      info.Issuer,
+				Subject:     info.Subject,
+				SANs:        info.SANs,
+			}
+		}
+		c.Probes[string(probeType)] = probe
+	}
+
+	return c
+}
+
+// truncate cuts s to at most max bytes, backing off to the start of a rune
+// so a multi-byte character is not split
+func truncate(s string, max int) (string, bool) {
+	if max <= 0 || len(s) <= max {
+		return s, false
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut], true
+}
+
+// ProbeResults rebuilds the probe results for the detector
+func (c Cassette) ProbeResults() (map[scanner.ProbeType]*scanner.ProbeResult, error) {
+	results := make(map[scanner.ProbeType]*scanner.ProbeResult, len(c.Probes))
+
+	for name, probe := range c.Probes {
+		duration, err := time.ParseDuration(probe.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("probe %s: invalid duration %q", name, probe.Duration)
+		}
+		result := &scanner.ProbeResult{
+			Type:       scanner.ProbeType(name),
+			StatusCode: probe.Status,
+			Headers:    probe.Headers,
+			Body:       probe.Body,
+			BodyLength: probe.BodyLength,
+			Duration:   duration,
+			URL:        probe.URL,
+			Samples:    probe.Samples,
+		}
+		if probe.Error != "" {
+			result.Error = replayedError(probe.Error, probe.ErrorType)
+		}
+		if req := probe.Request; req != nil {
+			result.Request = &scanner.ProbeRequest{
+				Method:  req.Method,
+				URL:     req.URL,
+				Headers: req.Headers,
+				Body:    req.Body,
+			}
+		}
+		if info := probe.TLS; info != nil {
+			result.TLS = &scanner.TLSInfo{
+				Version:     info.Version,
+				CipherSuite: info.CipherSuite,
+				ALPN:        info.ALPN,
+				Issuer:      info.Issuer,
+				Subject:     info.Subject,
+				SANs:        info.SANs,
+			}
+		}
+		results[result.Type] = result
+	}
+
+	return results, nil
+}
+
+// recordedError is a replayed probe failure. It reads exactly as recorded
+// and unwraps to a WAFError of the recorded type, so replayed results
+// report the same error_type as live ones.
+type recordedError struct {
+	message string
+	err     *waferrors.WAFError
+}
+
+func (e *recordedError) Error() string { return e.message }
+func (e *recordedError) Unwrap() error { return e.err }
+
+// replayedError rebuilds a recorded error; without a type it stays plain
+func replayedError(message, errType string) error {
+	if errType == "" {
+		return errors.New(message)
+	}
+	return &recordedError{
+		message: message,
+		err:     &waferrors.WAFError{Type: waferrors.ErrorType(errType), Message: message},
+	}
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// FileName is the name of the cassette file for target: a readable form of
+// the target followed by a digest, so that targets differing only in
+// characters that are replaced do not collide
+func FileName(target string) string {
+	readable := target
+	if i := strings.Index(readable, "://"); i >= 0 {
+		readable = readable[i+3:]
+	}
+	readable = strings.Trim(unsafeChars.ReplaceAllString(readable, "_"), "_")
+	if len(readable) > 100 {
+		readable = readable[:100]
+	}
+
+	sum := sha256.Sum256([]byte(target))
+	return readable + "-" + hex.EncodeToString(sum[:6]) + ".json"
+}
+
+// Recorder writes a cassette for every target scanned. It is safe for
+// concurrent use.
+type Recorder struct {
+	dir     string
+	maxBody int
+}
+
+// NewRecorder records into dir, creating it if needed, and truncates bodies
+// to maxBody bytes
+func NewRecorder(dir string, maxBody int) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	return &Recorder{dir: dir, maxBody: maxBody}, nil
+}
+
+// Record saves the probes of target, replacing any earlier recording
+func (r *Recorder) Record(target string, probes map[scanner.ProbeType]*scanner.ProbeResult) error {
+	// Payloads stay readable rather than escaped as \u003c
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(New(target, probes, r.maxBody)); err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+
+	// Write to a temporary file first so an interrupted run never leaves a
+	// partial cassette behind
+	path := filepath.Join(r.dir, FileName(target))
+	tmp, err := os.CreateTemp(r.dir, ".cassette-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// Player replays the cassettes in a directory instead of scanning. It is
+// safe for concurrent use.
+type Player struct {
+	dir string
+}
+
+// NewPlayer replays the cassettes in dir
+func NewPlayer(dir string) (*Player, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("failed to open cassette directory: %s is not a directory", dir)
+	}
+	return &Player{dir: dir}, nil
+}
+
+// Load reads the cassette of target
+func (p *Player) Load(target string) (Cassette, error) {
+	c, err := readFile(filepath.Join(p.dir, FileName(target)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Cassette{}, fmt.Errorf("%s: %w", target, ErrNotRecorded)
+	}
+	if err != nil {
+		return Cassette{}, err
+	}
+	if c.Target != target {
+		return Cassette{}, fmt.Errorf("%s: %w", target, ErrNotRecorded)
+	}
+	return c, nil
+}
+
+// Scan returns the recorded probe results of target. It has the signature of
+// scanner.Scanner.Scan so a Player can stand in for the scanner.
+func (p *Player) Scan(ctx context.Context, target string) (map[scanner.ProbeType]*scanner.ProbeResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c, err := p.Load(target)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProbeResults()
+}
+
+// Targets calls fn with the target of every cassette, in file name order,
+// until fn returns false
+func (p *Player) Targets(fn func(target string) bool) error {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cassette directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		target, err := readTarget(filepath.Join(p.dir, name))
+		if err != nil {
+			return err
+		}
+		if !fn(target) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func readFile(path string) (Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Cassette{}, err
+	}
+
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Cassette{}, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	if c.Version != formatVersion {
+		return Cassette{}, fmt.Errorf("cassette %s has unsupported version %d", path, c.Version)
+	}
+	return c, nil
+}
+
+// readTarget reads the target of a cassette without decoding the rest
+func readTarget(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return "", fmt.Errorf("failed to parse cassette %s: expected an object", path)
+	}
+	for {
+		key, err := dec.Token()
+		if err == io.EOF || key == json.Delim('}') {
+			return "", fmt.Errorf("failed to parse cassette %s: no target", path)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse cassette %s: %w", path, err)
+		}
+		if key == "target" {
+			var target string
+			if err := dec.Decode(&target); err != nil {
+				return "", fmt.Errorf("failed to parse cassette %s: %w", path, err)
+			}
+			return target, nil
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return "", fmt.Errorf("failed to parse cassette %s: %w", path, err)
+		}
+	}
+}
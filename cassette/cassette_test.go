@@ -0,0 +1,228 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	waferrors "github.com/ahmedtouahria/waf-detector/errors"
+	"github.com/ahmedtouahria/waf-detector/scanner"
+	"github.com/ahmedtouahria/waf-detector/wafdetector"
+)
+
+func TestRecordReplay(t *testing.T) {
+	// A WAF that blocks attack probes with a block page, and a target
+	// without one
+	mux := http.NewServeMux()
+	mux.HandleFunc("/waf/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "cloudflare")
+		w.Header().Set("CF-Ray", "7d1f3a2b9c0e4f21-CDG")
+		if r.URL.RawQuery != "" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Attention Required! | Cloudflare"))
+			return
+		}
+		w.Write([]byte("<html>Welcome</html>"))
+	})
+	mux.HandleFunc("/plain/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>Welcome</html>"))
+	})
+	srv := httptest.NewServer(mux)
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, DefaultMaxBody)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	client, err := wafdetector.New(wafdetector.WithRecorder(recorder), wafdetector.WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("wafdetector.New() error = %v", err)
+	}
+
+	targets := []string{srv.URL + "/waf/", srv.URL + "/plain/"}
+	scanned := make(map[string]wafdetector.Result)
+	for _, target := range targets {
+		result, err := client.Detect(context.Background(), target)
+		if err != nil {
+			t.Fatalf("Detect(%s) error = %v", target, err)
+		}
+		scanned[target] = result
+	}
+	srv.Close()
+
+	player, err := NewPlayer(dir)
+	if err != nil {
+		t.Fatalf("NewPlayer() error = %v", err)
+	}
+	replay, err := wafdetector.New(wafdetector.WithProber(player))
+	if err != nil {
+		t.Fatalf("wafdetector.New() error = %v", err)
+	}
+
+	var recorded []string
+	if err := player.Targets(func(target string) bool {
+		recorded = append(recorded, target)
+		return true
+	}); err != nil {
+		t.Fatalf("Targets() error = %v", err)
+	}
+	if len(recorded) != len(targets) {
+		t.Fatalf("Targets() = %v, want %v", recorded, targets)
+	}
+
+	for _, target := range recorded {
+		got, err := replay.Detect(context.Background(), target)
+		if err != nil {
+			t.Fatalf("replayed Detect(%s) error = %v", target, err)
+		}
+		want := scanned[target]
+		if got.WAFFound != want.WAFFound || got.WAFName != want.WAFName || got.Details != want.Details {
+			t.Errorf("replayed %s = %q (%s), scanned %q (%s)", target, got.WAFName, got.Details, want.WAFName, want.Details)
+		}
+	}
+	if !scanned[targets[0]].WAFFound || scanned[targets[1]].WAFFound {
+		t.Errorf("scanned results = %+v, want a WAF only on %s", scanned, targets[0])
+	}
+
+	_, err = replay.Detect(context.Background(), srv.URL+"/other/")
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("Detect() of an unrecorded target error = %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	probes := map[scanner.ProbeType]*scanner.ProbeResult{
+		scanner.ProbeNormal: {
+			Type:       scanner.ProbeNormal,
+			StatusCode: 200,
+			Headers:    http.Header{"Server": {"nginx"}},
+			Body:       strings.Repeat("a", 20),
+			BodyLength: 20,
+			Duration:   125 * time.Millisecond,
+			URL:        "https://example.com/",
+			Samples:    []string{strings.Repeat("b", 20)},
+			Request:    &scanner.ProbeRequest{Method: http.MethodGet, URL: "https://example.com"},
+			TLS:        &scanner.TLSInfo{Version: "TLS 1.3", ALPN: "h2", SANs: []string{"sni.cloudflaressl.com"}},
+		},
+		scanner.ProbeSQLi: {
+			Type:     scanner.ProbeSQLi,
+			Duration: time.Second,
+			Error:    waferrors.NewTimeoutError("https://example.com"),
+		},
+		scanner.ProbeXSS: {
+			Type:     scanner.ProbeXSS,
+			Duration: time.Second,
+			Error:    errors.New("connection reset"),
+		},
+	}
+
+	c := New("https://example.com", probes, 8)
+	results, err := c.ProbeResults()
+	if err != nil {
+		t.Fatalf("ProbeResults() error = %v", err)
+	}
+
+	normal := results[scanner.ProbeNormal]
+	if normal.Body != "aaaaaaaa" || normal.BodyLength != 20 || !c.Probes["normal"].Truncated {
+		t.Errorf("body = %q (length %d), want the first 8 bytes of a 20 byte body", normal.Body, normal.BodyLength)
+	}
+	if len(normal.Samples) != 1 || normal.Samples[0] != "bbbbbbbb" {
+		t.Errorf("samples = %q, want truncated samples", normal.Samples)
+	}
+	if normal.Duration != 125*time.Millisecond || normal.Headers.Get("Server") != "nginx" || normal.URL != "https://example.com/" {
+		t.Errorf("normal probe = %+v, want the recorded duration, headers and URL", normal)
+	}
+	if normal.Request == nil || normal.Request.Method != http.MethodGet {
+		t.Errorf("request = %+v, want the recorded request", normal.Request)
+	}
+	if tls := normal.TLS; tls == nil || tls.Version != "TLS 1.3" || tls.ALPN != "h2" || len(tls.SANs) != 1 {
+		t.Errorf("TLS = %+v, want the recorded connection", tls)
+	}
+	sqli := results[scanner.ProbeSQLi]
+	if want := probes[scanner.ProbeSQLi].Error.Error(); sqli.Error == nil || sqli.Error.Error() != want {
+		t.Errorf("sqli error = %v, want %s", sqli.Error, want)
+	}
+	if got := waferrors.TypeOf(sqli.Error); got != waferrors.ErrorTypeTimeout {
+		t.Errorf("sqli error type = %s, want TIMEOUT", got)
+	}
+	if xss := results[scanner.ProbeXSS]; xss.Error == nil || xss.Error.Error() != "connection reset" {
+		t.Errorf("xss error = %v, want connection reset", xss.Error)
+	}
+
+	// Cassettes recorded without error types still replay
+	old := Cassette{Version: formatVersion, Probes: map[string]Probe{
+		"normal": {Duration: "1s", Error: "[TIMEOUT] https://example.com: Request timeout"},
+	}}
+	results, err = old.ProbeResults()
+	if err != nil {
+		t.Fatalf("ProbeResults() error = %v", err)
+	}
+	if normal := results[scanner.ProbeNormal]; normal.Error == nil || normal.Error.Error() != old.Probes["normal"].Error {
+		t.Errorf("error without a type = %v, want the recorded message", normal.Error)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name          string
+		s             string
+		max           int
+		want          string
+		wantTruncated bool
+	}{
+		{"short", "abc", 8, "abc", false},
+		{"unlimited", "abcdef", 0, "abcdef", false},
+		{"ascii", "abcdef", 4, "abcd", true},
+		{"rune boundary", "héllo", 3, "hé", true},
+		{"inside two-byte rune", "héllo", 2, "h", true},
+		{"inside four-byte rune", "a😀b", 3, "a", true},
+		{"inside three-byte rune", "被阻止", 4, "被", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := truncate(tt.s, tt.max)
+			if got != tt.want || truncated != tt.wantTruncated {
+				t.Errorf("truncate(%q, %d) = %q, %v, want %q, %v", tt.s, tt.max, got, truncated, tt.want, tt.wantTruncated)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncate(%q, %d) = %q, not valid UTF-8", tt.s, tt.max, got)
+			}
+		})
+	}
+}
+
+func TestFileName(t *testing.T) {
+	a := FileName("https://example.com/a?b=1")
+	if !strings.HasPrefix(a, "example.com_a_b_1-") || filepath.Ext(a) != ".json" {
+		t.Errorf("FileName() = %q, want a readable name", a)
+	}
+	if b := FileName("http://example.com/a?b=1"); a == b {
+		t.Errorf("FileName() gave %q for two targets", a)
+	}
+}
+
+func TestPlayerErrors(t *testing.T) {
+	if _, err := NewPlayer(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("NewPlayer() should reject a missing directory")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FileName("https://example.com")), []byte(`{"target": "https://example.com", "version": 99}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	player, err := NewPlayer(dir)
+	if err != nil {
+		t.Fatalf("NewPlayer() error = %v", err)
+	}
+	if _, err := player.Scan(context.Background(), "https://example.com"); err == nil || !strings.Contains(err.Error(), "unsupported version") {
+		t.Errorf("Scan() error = %v, want an unsupported version error", err)
+	}
+}
@@ -0,0 +1,283 @@
+// Package checkpoint records the results of a scan as targets complete so an
+// interrupted run can be resumed.
+//
+// A state file is JSON Lines: a header holding the scan options, followed by
+// one output.Result per completed target.
+package checkpoint
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ahmedtouahria/waf-detector/cli"
+	"github.com/ahmedtouahria/waf-detector/output"
+	"github.com/ahmedtouahria/waf-detector/signatures"
+)
+
+// formatVersion is bumped when the state file layout changes
+const formatVersion = 2
+
+// Options are the scan settings that affect results. A state file can only
+// be resumed with the options it was created with.
+type Options struct {
+	Signatures    string  `json:"signatures"`
+	MinConfidence float64 `json:"min_confidence"`
+	Timeout       string  `json:"timeout"`
+	UserAgent     string  `json:"user_agent"`
+	Proxy         string  `json:"proxy"`
+
+	// Source is "live", or "replay:<dir>" when detecting from cassettes
+	Source string `json:"source"`
+
+	Retries         int    `json:"retries"`
+	RetryBackoff    string `json:"retry_backoff"`
+	RetryMaxBackoff string `json:"retry_max_backoff"`
+
+	Rate        float64 `json:"rate"`
+	PerHostRate float64 `json:"per_host_rate"`
+	Delay       string  `json:"delay"`
+	Jitter      string  `json:"jitter"`
+	MaxPerHost  int     `json:"max_per_host"`
+
+	HTTP2 bool `json:"http2"`
+}
+
+// OptionsFromConfig extracts the result-affecting options of a run.
+// Signatures are identified by a digest of the embedded signatures and the
+// custom files merged over them, so an upgraded binary or an edited file is
+// caught too.
+func OptionsFromConfig(config *cli.Config) (Options, error) {
+	opts := Options{
+		MinConfidence: config.MinConfidence,
+		Timeout:       config.Timeout.String(),
+		UserAgent:     config.UserAgent,
+		Proxy:         config.Proxy,
+		Source:        "live",
+
+		Retries:         config.Retries,
+		RetryBackoff:    config.RetryBackoff.String(),
+		RetryMaxBackoff: config.RetryMaxBackoff.String(),
+
+		Rate:        config.Rate,
+		PerHostRate: config.PerHostRate,
+		Delay:       config.Delay.String(),
+		Jitter:      config.Jitter.String(),
+		MaxPerHost:  config.MaxPerHost,
+
+		HTTP2: config.HTTP2,
+	}
+	if config.ReplayDir != "" {
+		opts.Source = "replay:" + config.ReplayDir
+	}
+
+	files, err := signatures.SignatureFiles(config.SignaturesFiles)
+	if err != nil {
+		return Options{}, err
+	}
+
+	// Hash the digest of each file in merge order after the embedded
+	// signatures, since reordering files changes which signatures win
+	h := sha256.New()
+	h.Write([]byte(signatures.EmbeddedDigest()))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return Options{}, fmt.Errorf("failed to read signatures file: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		h.Write(sum[:])
+	}
+	opts.Signatures = "sha256:" + hex.EncodeToString(h.Sum(nil))
+
+	return opts, nil
+}
+
+// diff lists the options that differ from other as "name (old vs new)"
+func (o Options) diff(other Options) []string {
+	var diffs []string
+	add := func(name string, a, b interface{}) {
+		if a != b {
+			diffs = append(diffs, fmt.Sprintf("%s (%v vs %v)", name, a, b))
+		}
+	}
+	add("signatures", o.Signatures, other.Signatures)
+	add("min_confidence", o.MinConfidence, other.MinConfidence)
+	add("timeout", o.Timeout, other.Timeout)
+	add("user_agent", o.UserAgent, other.UserAgent)
+	add("proxy", o.Proxy, other.Proxy)
+	add("source", o.Source, other.Source)
+	add("retries", o.Retries, other.Retries)
+	add("retry_backoff", o.RetryBackoff, other.RetryBackoff)
+	add("retry_max_backoff", o.RetryMaxBackoff, other.RetryMaxBackoff)
+	add("rate", o.Rate, other.Rate)
+	add("per_host_rate", o.PerHostRate, other.PerHostRate)
+	add("delay", o.Delay, other.Delay)
+	add("jitter", o.Jitter, other.Jitter)
+	add("max_per_host", o.MaxPerHost, other.MaxPerHost)
+	add("http2", o.HTTP2, other.HTTP2)
+	return diffs
+}
+
+type header struct {
+	Version int     `json:"version"`
+	Options Options `json:"options"`
+}
+
+// State is an open state file. It is safe for concurrent use.
+type State struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	done    map[string]bool
+
+	// previous is the number of entries recorded by earlier runs
+	previous int
+}
+
+// Open opens the state file at path, creating it when it does not exist. An
+// existing file must have been created with the same options. A partial last
+// line left by a crash is discarded.
+func Open(path string, opts Options) (*State, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+
+	s := &State{
+		path:    path,
+		file:    file,
+		encoder: json.NewEncoder(file),
+		done:    make(map[string]bool),
+	}
+
+	if err := s.load(opts); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load validates the header and indexes completed targets, writing a header
+// to a new file
+func (s *State) load(opts Options) error {
+	reader := bufio.NewReader(s.file)
+
+	line, err := reader.ReadBytes('\n')
+	if len(line) == 0 && err == io.EOF {
+		return s.encoder.Encode(header{Version: formatVersion, Options: opts})
+	}
+
+	var h header
+	if err != nil || json.Unmarshal(line, &h) != nil {
+		return fmt.Errorf("%s is not a waf-detector state file", s.path)
+	}
+	if h.Version != formatVersion {
+		return fmt.Errorf("%s: unsupported state file version %d", s.path, h.Version)
+	}
+	if diffs := h.Options.diff(opts); len(diffs) > 0 {
+		return fmt.Errorf("%s was created with different options: %s", s.path, strings.Join(diffs, ", "))
+	}
+
+	offset := int64(len(line))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read state file: %w", err)
+		}
+
+		var result output.Result
+		if json.Unmarshal(line, &result) != nil {
+			return fmt.Errorf("%s: corrupt entry at offset %d", s.path, offset)
+		}
+		s.done[result.URL] = true
+		s.previous++
+		offset += int64(len(line))
+	}
+
+	// Drop a partially written entry and append after the last complete one
+	if err := s.file.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate state file: %w", err)
+	}
+	if _, err := s.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek state file: %w", err)
+	}
+	return nil
+}
+
+// Previous returns the number of results recorded by earlier runs
+func (s *State) Previous() int {
+	return s.previous
+}
+
+// Done reports whether target has already been scanned
+func (s *State) Done(target string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done[target]
+}
+
+// Record appends a completed result to the state file
+func (s *State) Record(result output.Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.encoder.Encode(result); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	s.done[result.URL] = true
+	return nil
+}
+
+// Replay calls fn with every result recorded by earlier runs. Results are
+// read back from disk one at a time rather than held in memory.
+func (s *State) Replay(fn func(output.Result) error) error {
+	if s.previous == 0 {
+		return nil
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open state file: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if _, err := reader.ReadBytes('\n'); err != nil {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	for i := 0; i < s.previous; i++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read state file: %w", err)
+		}
+
+		var result output.Result
+		if err := json.Unmarshal(line, &result); err != nil {
+			return fmt.Errorf("failed to decode state file entry: %w", err)
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the state file
+func (s *State) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
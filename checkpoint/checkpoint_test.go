@@ -0,0 +1,172 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedtouahria/waf-detector/cli"
+	"github.com/ahmedtouahria/waf-detector/output"
+)
+
+func TestResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.state")
+	opts := Options{Signatures: "embedded", MinConfidence: 0.3, Timeout: "10s", UserAgent: "waf-detector/1.0"}
+
+	state, err := Open(path, opts)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for _, result := range []output.Result{
+		{URL: "https://a.example", WAFFound: true, WAFName: "Cloudflare"},
+		{URL: "https://b.example"},
+	} {
+		if err := state.Record(result); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	state.Close()
+
+	// Simulate a crash in the middle of writing the next entry
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"url":"https://c.exa`)
+	file.Close()
+
+	state, err = Open(path, opts)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer state.Close()
+
+	if state.Previous() != 2 {
+		t.Errorf("Previous() = %d, want 2", state.Previous())
+	}
+	if !state.Done("https://a.example") || state.Done("https://c.example") {
+		t.Error("Done() should report only recorded targets")
+	}
+
+	if err := state.Record(output.Result{URL: "https://c.example"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var replayed []string
+	err = state.Replay(func(result output.Result) error {
+		replayed = append(replayed, result.URL)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if strings.Join(replayed, ",") != "https://a.example,https://b.example" {
+		t.Errorf("Replay() = %v, want results from the earlier run only", replayed)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 4 {
+		t.Errorf("state file has %d lines, want header and 3 entries:\n%s", lines, data)
+	}
+}
+
+func TestResumeRejectsDifferentOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.state")
+	opts := Options{Signatures: "embedded", MinConfidence: 0.3, Timeout: "10s", Source: "live", Retries: 2, Delay: "0s"}
+
+	state, err := Open(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Close()
+
+	changed := opts
+	changed.Timeout = "5s"
+	changed.Signatures = "sha256:abc"
+	changed.Source = "replay:scans"
+	changed.Retries = 3
+	changed.Rate = 5
+	changed.Delay = "500ms"
+
+	_, err = Open(path, changed)
+	if err == nil {
+		t.Fatal("expected error for different options")
+	}
+	for _, want := range []string{
+		"timeout (10s vs 5s)",
+		"signatures (embedded vs sha256:abc)",
+		"source (live vs replay:scans)",
+		"retries (2 vs 3)",
+		"rate (0 vs 5)",
+		"delay (0s vs 500ms)",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %q", err, want)
+		}
+	}
+}
+
+func TestOptionsFromConfig(t *testing.T) {
+	live, err := OptionsFromConfig(&cli.Config{Timeout: 10 * time.Second, Retries: 2, RetryBackoff: 500 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay, err := OptionsFromConfig(&cli.Config{Timeout: 10 * time.Second, Retries: 2, RetryBackoff: 500 * time.Millisecond, ReplayDir: "scans"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if live.Source != "live" || live.Retries != 2 || live.RetryBackoff != "500ms" {
+		t.Errorf("options = %+v, want a live scan with 2 retries after 500ms", live)
+	}
+	if diffs := live.diff(replay); len(diffs) != 1 || diffs[0] != "source (live vs replay:scans)" {
+		t.Errorf("diff() = %q, want only the source", diffs)
+	}
+}
+
+func TestOptionsFromConfigSignatures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.yml")
+	if err := os.WriteFile(path, []byte("signatures: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	embedded, err := OptionsFromConfig(&cli.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom, err := OptionsFromConfig(&cli.Config{SignaturesFiles: []string{path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(embedded.Signatures, "sha256:") || embedded.Signatures == custom.Signatures {
+		t.Errorf("signatures = %q and %q, want distinct sha256 digests", embedded.Signatures, custom.Signatures)
+	}
+
+	if err := os.WriteFile(path, []byte("signatures: []\n# edited\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	edited, err := OptionsFromConfig(&cli.Config{SignaturesFiles: []string{path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.Signatures == custom.Signatures {
+		t.Error("editing a signatures file did not change the digest")
+	}
+}
+
+func TestOpenRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(path, []byte("https://example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path, Options{}); err == nil || !strings.Contains(err.Error(), "not a waf-detector state file") {
+		t.Errorf("expected state file error, got: %v", err)
+	}
+}
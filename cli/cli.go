@@ -4,75 +4,221 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/ahmedtouahria/waf-detector/ratelimit"
 )
 
 type Config struct {
-	URL            string
-	ListFile       string
-	ConfigFile     string
-	SignaturesFile string
-	Threads        int
-	OutputFile     string
-	Format         string
-	Timeout        time.Duration
-	Proxy          string
-	UserAgent      string
-	Silent         bool
-	NoColor        bool
-	Debug          bool
-	ShowVersion    bool
+	URL           string
+	Targets       []string
+	ListFile      string
+	ConfigFile    string
+	Threads       int
+	OutputFile    string
+	Format        string
+	Timeout       time.Duration
+	MinConfidence float64
+	Proxy         string
+	UserAgent     string
+	Silent        bool
+	NoColor       bool
+	Debug         bool
+	ShowVersion   bool
+	PrintConfig   bool
+	Listen        string
+	ResumeFile    string
+	RecordDir     string
+	ReplayDir     string
+
+	// Rate limits; zero leaves a limit off
+	Rate        float64
+	PerHostRate float64
+	Delay       time.Duration
+	Jitter      time.Duration
+	MaxPerHost  int
+
+	// Retries of probes that fail with transient errors
+	Retries         int
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+
+	// HTTP2 offers HTTP/2 when connecting over TLS
+	HTTP2 bool
+
+	// SignaturesFiles are signature files and directories merged over the
+	// embedded signatures, in order
+	SignaturesFiles []string
+
+	// explicit records the flags given on the command line
+	explicit map[string]bool
 }
 
+// Formats lists the supported output formats
+var Formats = []string{"txt", "json", "jsonl", "csv", "html", "sarif"}
+
+// StringList is a flag that collects every value it is given, for flags
+// that can be repeated
+type StringList []string
+
+func (l *StringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *StringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// IsSet reports whether any of the named flags was given on the command line
+func (c *Config) IsSet(names ...string) bool {
+	for _, name := range names {
+		if c.explicit[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimits returns the configured request rate limits
+func (c *Config) RateLimits() ratelimit.Limits {
+	return ratelimit.Limits{
+		Rate:        c.Rate,
+		PerHostRate: c.PerHostRate,
+		Delay:       c.Delay,
+		Jitter:      c.Jitter,
+		MaxPerHost:  c.MaxPerHost,
+	}
+}
+
+// Validate checks settings that may come from flags, a config file or the environment
+func (c *Config) Validate() error {
+	if c.Threads < 1 {
+		return fmt.Errorf("invalid threads %d. Use at least 1", c.Threads)
+	}
+
+	if c.Timeout <= 0 {
+		return fmt.Errorf("invalid timeout %v. Use a positive duration", c.Timeout)
+	}
+
+	if c.MinConfidence < 0 || c.MinConfidence > 1 {
+		return fmt.Errorf("invalid min-confidence %.2f. Use a value between 0 and 1", c.MinConfidence)
+	}
+
+	if err := c.RateLimits().Validate(); err != nil {
+		return err
+	}
+
+	if c.Retries < 0 || c.RetryBackoff < 0 || c.RetryMaxBackoff < 0 {
+		return fmt.Errorf("retries and retry backoff must not be negative")
+	}
+
+	if c.RecordDir != "" && c.ReplayDir != "" {
+		return fmt.Errorf("--record and --replay cannot be used together")
+	}
+
+	for _, format := range Formats {
+		if c.Format == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid format '%s'. Use one of: %s", c.Format, strings.Join(Formats, ", "))
+}
+
+// ParseFlags parses the process command line
 func ParseFlags() *Config {
+	return ParseArgs("waf-detector", os.Args[1:])
+}
+
+// ParseArgs parses args for the named command. Subcommands such as serve use
+// it with the arguments that follow the subcommand name.
+func ParseArgs(name string, args []string) *Config {
 	config := &Config{}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
 
-	flag.StringVar(&config.URL, "u", "", "Single target URL")
-	flag.StringVar(&config.URL, "url", "", "Single target URL")
-	flag.StringVar(&config.ListFile, "l", "", "File with list of URLs")
-	flag.StringVar(&config.ListFile, "list", "", "File with list of URLs")
-	flag.StringVar(&config.ConfigFile, "c", "", "Config file path (YAML)")
-	flag.StringVar(&config.ConfigFile, "config", "", "Config file path (YAML)")
-	flag.StringVar(&config.SignaturesFile, "s", "", "Custom WAF signatures file (YAML)")
-	flag.StringVar(&config.SignaturesFile, "signatures", "", "Custom WAF signatures file (YAML)")
-	flag.IntVar(&config.Threads, "t", 10, "Number of concurrent workers")
-	flag.IntVar(&config.Threads, "threads", 10, "Number of concurrent workers")
-	flag.StringVar(&config.OutputFile, "o", "", "Output file path")
-	flag.StringVar(&config.OutputFile, "output", "", "Output file path")
-	flag.StringVar(&config.Format, "f", "txt", "Output format: txt | json | csv | html")
-	flag.StringVar(&config.Format, "format", "txt", "Output format: txt | json | csv | html")
+	fs.StringVar(&config.URL, "u", "", "Single target URL")
+	fs.StringVar(&config.URL, "url", "", "Single target URL")
+	fs.StringVar(&config.ListFile, "l", "", "File with list of URLs")
+	fs.StringVar(&config.ListFile, "list", "", "File with list of URLs")
+	fs.StringVar(&config.ConfigFile, "c", "", "Config file path (YAML)")
+	fs.StringVar(&config.ConfigFile, "config", "", "Config file path (YAML)")
+	fs.Var((*StringList)(&config.SignaturesFiles), "s", "Signatures file or directory (YAML) merged over the embedded signatures; repeatable")
+	fs.Var((*StringList)(&config.SignaturesFiles), "signatures", "Signatures file or directory (YAML) merged over the embedded signatures; repeatable")
+	fs.IntVar(&config.Threads, "t", 10, "Number of concurrent workers")
+	fs.IntVar(&config.Threads, "threads", 10, "Number of concurrent workers")
+	fs.StringVar(&config.OutputFile, "o", "", "Output file path")
+	fs.StringVar(&config.OutputFile, "output", "", "Output file path")
+	fs.StringVar(&config.Format, "f", "txt", "Output format: txt | json | jsonl | csv | html | sarif")
+	fs.StringVar(&config.Format, "format", "txt", "Output format: txt | json | jsonl | csv | html | sarif")
 
 	var timeoutSecs int
-	flag.IntVar(&timeoutSecs, "timeout", 10, "HTTP timeout per request (seconds)")
+	fs.IntVar(&timeoutSecs, "timeout", 10, "HTTP timeout per request (seconds)")
+
+	fs.Float64Var(&config.MinConfidence, "min-confidence", 0.3, "Minimum confidence (0-1) for a WAF/CDN layer to be reported")
 
-	flag.StringVar(&config.Proxy, "proxy", "", "HTTP proxy URL")
-	flag.StringVar(&config.UserAgent, "user-agent", "waf-detector/1.0", "Custom User-Agent")
-	flag.BoolVar(&config.Silent, "silent", false, "Only print results")
-	flag.BoolVar(&config.NoColor, "no-color", false, "Disable colored output")
-	flag.BoolVar(&config.Debug, "debug", false, "Verbose debug mode")
-	flag.BoolVar(&config.ShowVersion, "version", false, "Show version information")
-	flag.BoolVar(&config.ShowVersion, "v", false, "Show version information")
+	fs.Float64Var(&config.Rate, "rate", 0, "Maximum requests per second across all hosts (0 = unlimited)")
+	fs.Float64Var(&config.PerHostRate, "per-host-rate", 0, "Maximum requests per second to each host (0 = unlimited)")
+	fs.DurationVar(&config.Delay, "delay", 0, "Pause between requests to the same host, e.g. 500ms")
+	fs.DurationVar(&config.Jitter, "jitter", 0, "Random extra pause of up to this duration added to --delay")
+	fs.IntVar(&config.MaxPerHost, "max-per-host", 0, "Maximum requests in flight to each host (0 = unlimited)")
 
-	flag.Usage = func() {
+	fs.IntVar(&config.Retries, "retries", 2, "Retries of probes failing with transient errors such as timeouts and resets")
+	fs.DurationVar(&config.RetryBackoff, "retry-backoff", 500*time.Millisecond, "Pause before the first retry, doubled for each further retry")
+	fs.DurationVar(&config.RetryMaxBackoff, "retry-max-backoff", 5*time.Second, "Longest pause between retries")
+
+	fs.BoolVar(&config.HTTP2, "http2", false, "Offer HTTP/2 over TLS, so the negotiated ALPN can be matched by signatures; probes are then sent over HTTP/2 where supported")
+
+	fs.StringVar(&config.Proxy, "proxy", "", "HTTP proxy URL")
+	fs.StringVar(&config.UserAgent, "user-agent", "waf-detector/1.0", "Custom User-Agent")
+	fs.BoolVar(&config.Silent, "silent", false, "Only print results")
+	fs.BoolVar(&config.NoColor, "no-color", false, "Disable colored output")
+	fs.BoolVar(&config.Debug, "debug", false, "Verbose debug mode")
+	fs.BoolVar(&config.ShowVersion, "version", false, "Show version information")
+	fs.BoolVar(&config.ShowVersion, "v", false, "Show version information")
+	fs.BoolVar(&config.PrintConfig, "print-config", false, "Print the effective configuration and where each value came from, then exit")
+
+	fs.StringVar(&config.Listen, "listen", "127.0.0.1:8080", "Listen address for serve mode; the API has no authentication, so only bind it to trusted interfaces")
+	fs.StringVar(&config.ResumeFile, "resume", "", "State file recording completed targets; rerun with the same file to resume")
+	fs.StringVar(&config.RecordDir, "record", "", "Directory to save every target's probe responses to, for --replay")
+	fs.StringVar(&config.ReplayDir, "replay", "", "Directory of probe responses saved with --record to detect from instead of scanning; replays every target unless targets are given")
+
+	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, "waf-detector - Web Application Firewall Detection Tool\n\n")
 		fmt.Fprintf(os.Stderr, "Usage:\n")
-		fmt.Fprintf(os.Stderr, "  waf-detector [options]\n\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector [options]\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector serve [options]    Run the REST API server\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector sigs validate|lint <file>...    Check signature files\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector sigs test [-s file] [fixture|dir]...    Test signatures against recorded responses\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector emulate [-vendor name]    Serve recorded WAF responses for offline scans\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
+		fs.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  waf-detector -u https://example.com\n")
 		fmt.Fprintf(os.Stderr, "  waf-detector -l targets.txt -t 20 -o results.json -f json\n")
 		fmt.Fprintf(os.Stderr, "  waf-detector -u https://example.com --debug\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector -l targets.txt -f jsonl -o results.jsonl --resume scan.state\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector -l targets.txt --rate 20 --per-host-rate 2 --delay 500ms --jitter 250ms --max-per-host 1\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector -u https://example.com -s signatures.d -s vendor.yml\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector -l targets.txt --record scans/2025-12-31\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector --replay scans/2025-12-31 -s tuned.yml -f jsonl -o results.jsonl\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector -c configs/example.yml --print-config\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector serve --listen 127.0.0.1:8080 -t 20\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector sigs lint my-signatures.yml\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector sigs test -s my-signatures.yml testdata/fixtures\n")
+		fmt.Fprintf(os.Stderr, "  waf-detector emulate -vendor cloudflare -addr 127.0.0.1:8081\n")
+		fmt.Fprintf(os.Stderr, "\nSettings are resolved as: defaults < config file < WAF_DETECTOR_* environment < flags\n")
 	}
 
-	flag.Parse()
+	// ExitOnError makes Parse exit on bad flags
+	_ = fs.Parse(args)
 
 	config.Timeout = time.Duration(timeoutSecs) * time.Second
 
-	if config.Format != "txt" && config.Format != "json" && config.Format != "csv" && config.Format != "html" {
-		fmt.Fprintf(os.Stderr, "Error: Invalid format '%s'. Use 'txt', 'json', 'csv', or 'html'\n", config.Format)
-		os.Exit(1)
-	}
+	config.explicit = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		config.explicit[f.Name] = true
+	})
 
 	return config
 }
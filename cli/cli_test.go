@@ -28,3 +28,56 @@ func TestConfig(t *testing.T) {
 		t.Errorf("Format = %s, want json", config.Format)
 	}
 }
+
+func TestParseArgsRepeatedSignatures(t *testing.T) {
+	config := ParseArgs("waf-detector", []string{"-s", "signatures.d", "--signatures", "vendor.yml", "-s", "overrides.yml"})
+
+	want := []string{"signatures.d", "vendor.yml", "overrides.yml"}
+	if len(config.SignaturesFiles) != len(want) {
+		t.Fatalf("SignaturesFiles = %q, want %q", config.SignaturesFiles, want)
+	}
+	for i := range want {
+		if config.SignaturesFiles[i] != want[i] {
+			t.Errorf("SignaturesFiles[%d] = %q, want %q", i, config.SignaturesFiles[i], want[i])
+		}
+	}
+	if !config.IsSet("s") {
+		t.Error("IsSet(\"s\") = false")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := func() *Config {
+		return &Config{Format: "txt", Threads: 10, Timeout: 10 * time.Second}
+	}
+
+	for _, format := range Formats {
+		config := valid()
+		config.Format = format
+		if err := config.Validate(); err != nil {
+			t.Errorf("Validate() with format %q: %v", format, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+	}{
+		{"unknown format", func(c *Config) { c.Format = "xml" }},
+		{"record with replay", func(c *Config) { c.RecordDir, c.ReplayDir = "a", "b" }},
+		{"zero threads", func(c *Config) { c.Threads = 0 }},
+		{"negative threads", func(c *Config) { c.Threads = -1 }},
+		{"zero timeout", func(c *Config) { c.Timeout = 0 }},
+		{"negative timeout", func(c *Config) { c.Timeout = -time.Second }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid()
+			tt.modify(config)
+			if err := config.Validate(); err == nil {
+				t.Error("Validate() = nil, want an error")
+			}
+		})
+	}
+}
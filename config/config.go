@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -10,28 +12,54 @@ import (
 
 // FileConfig represents the YAML configuration file structure
 type FileConfig struct {
-	Targets    []string      `yaml:"targets"`
-	Threads    int           `yaml:"threads"`
-	Timeout    time.Duration `yaml:"timeout"`
-	Proxy      string        `yaml:"proxy"`
-	UserAgent  string        `yaml:"user_agent"`
-	OutputFile string        `yaml:"output_file"`
-	Format     string        `yaml:"format"`
-	Silent     bool          `yaml:"silent"`
-	NoColor    bool          `yaml:"no_color"`
-	Debug      bool          `yaml:"debug"`
+	Targets         []string      `yaml:"targets"`
+	ListFile        string        `yaml:"list"`
+	SignaturesFiles Paths         `yaml:"signatures"`
+	Threads         int           `yaml:"threads"`
+	Timeout         time.Duration `yaml:"timeout"`
+	MinConfidence   float64       `yaml:"min_confidence"`
+	Proxy           string        `yaml:"proxy"`
+	UserAgent       string        `yaml:"user_agent"`
+	OutputFile      string        `yaml:"output_file"`
+	Format          string        `yaml:"format"`
+	Silent          bool          `yaml:"silent"`
+	NoColor         bool          `yaml:"no_color"`
+	Debug           bool          `yaml:"debug"`
+	Listen          string        `yaml:"listen"`
+	Rate            float64       `yaml:"rate"`
+	PerHostRate     float64       `yaml:"per_host_rate"`
+	Delay           time.Duration `yaml:"delay"`
+	Jitter          time.Duration `yaml:"jitter"`
+	MaxPerHost      int           `yaml:"max_per_host"`
+	Retries         int           `yaml:"retries"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff"`
+	HTTP2           bool          `yaml:"http2"`
+}
+
+// Paths is a list of file paths. In YAML it is a single path or a list.
+type Paths []string
+
+// UnmarshalYAML accepts a scalar or a sequence of paths
+func (p *Paths) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*p = Paths{value.Value}
+		return nil
+	}
+
+	var paths []string
+	if err := value.Decode(&paths); err != nil {
+		return fmt.Errorf("expected a path or a list of paths: %w", err)
+	}
+	*p = paths
+	return nil
 }
 
 // LoadConfig loads configuration from a YAML file
 func LoadConfig(path string) (*FileConfig, error) {
-	data, err := os.ReadFile(path)
+	cfg, _, err := loadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	var cfg FileConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+		return nil, err
 	}
 
 	// Set defaults
@@ -48,42 +76,130 @@ func LoadConfig(path string) (*FileConfig, error) {
 		cfg.Format = "txt"
 	}
 
-	return &cfg, nil
+	return cfg, nil
 }
 
 // LoadFromEnv loads configuration values from environment variables
 func LoadFromEnv() *FileConfig {
-	cfg := &FileConfig{}
+	cfg, _, _ := loadEnv()
+	return cfg
+}
 
-	if val := os.Getenv("WAF_DETECTOR_THREADS"); val != "" {
-		fmt.Sscanf(val, "%d", &cfg.Threads)
-	}
-	if val := os.Getenv("WAF_DETECTOR_TIMEOUT"); val != "" {
-		var secs int
-		fmt.Sscanf(val, "%d", &secs)
-		cfg.Timeout = time.Duration(secs) * time.Second
-	}
-	if val := os.Getenv("WAF_DETECTOR_PROXY"); val != "" {
-		cfg.Proxy = val
-	}
-	if val := os.Getenv("WAF_DETECTOR_USER_AGENT"); val != "" {
-		cfg.UserAgent = val
-	}
-	if val := os.Getenv("WAF_DETECTOR_OUTPUT"); val != "" {
-		cfg.OutputFile = val
+// loadFile parses a config file and reports which keys it sets
+func loadFile(path string) (*FileConfig, map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
 	}
-	if val := os.Getenv("WAF_DETECTOR_FORMAT"); val != "" {
-		cfg.Format = val
+
+	var cfg FileConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
-	if val := os.Getenv("WAF_DETECTOR_SILENT"); val == "true" || val == "1" {
-		cfg.Silent = true
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
-	if val := os.Getenv("WAF_DETECTOR_NO_COLOR"); val == "true" || val == "1" {
-		cfg.NoColor = true
+
+	keys := make(map[string]bool, len(raw))
+	for key := range raw {
+		keys[key] = true
 	}
-	if val := os.Getenv("WAF_DETECTOR_DEBUG"); val == "true" || val == "1" {
-		cfg.Debug = true
+
+	return &cfg, keys, nil
+}
+
+// envVars maps config keys to the environment variables that set them
+var envVars = map[string]string{
+	"signatures":        "WAF_DETECTOR_SIGNATURES",
+	"threads":           "WAF_DETECTOR_THREADS",
+	"timeout":           "WAF_DETECTOR_TIMEOUT",
+	"min_confidence":    "WAF_DETECTOR_MIN_CONFIDENCE",
+	"proxy":             "WAF_DETECTOR_PROXY",
+	"user_agent":        "WAF_DETECTOR_USER_AGENT",
+	"output_file":       "WAF_DETECTOR_OUTPUT",
+	"format":            "WAF_DETECTOR_FORMAT",
+	"silent":            "WAF_DETECTOR_SILENT",
+	"no_color":          "WAF_DETECTOR_NO_COLOR",
+	"debug":             "WAF_DETECTOR_DEBUG",
+	"listen":            "WAF_DETECTOR_LISTEN",
+	"rate":              "WAF_DETECTOR_RATE",
+	"per_host_rate":     "WAF_DETECTOR_PER_HOST_RATE",
+	"delay":             "WAF_DETECTOR_DELAY",
+	"jitter":            "WAF_DETECTOR_JITTER",
+	"max_per_host":      "WAF_DETECTOR_MAX_PER_HOST",
+	"retries":           "WAF_DETECTOR_RETRIES",
+	"retry_backoff":     "WAF_DETECTOR_RETRY_BACKOFF",
+	"retry_max_backoff": "WAF_DETECTOR_RETRY_MAX_BACKOFF",
+	"http2":             "WAF_DETECTOR_HTTP2",
+}
+
+// loadEnv reads the WAF_DETECTOR_* environment variables and reports which
+// config keys they set
+func loadEnv() (*FileConfig, map[string]bool, error) {
+	cfg := &FileConfig{}
+	keys := make(map[string]bool)
+
+	for key, name := range envVars {
+		val := os.Getenv(name)
+		if val == "" {
+			continue
+		}
+
+		var err error
+		switch key {
+		case "signatures":
+			// Several paths are separated like PATH entries
+			cfg.SignaturesFiles = filepath.SplitList(val)
+		case "threads":
+			cfg.Threads, err = strconv.Atoi(val)
+		case "timeout":
+			var secs int
+			secs, err = strconv.Atoi(val)
+			cfg.Timeout = time.Duration(secs) * time.Second
+		case "min_confidence":
+			cfg.MinConfidence, err = strconv.ParseFloat(val, 64)
+		case "proxy":
+			cfg.Proxy = val
+		case "user_agent":
+			cfg.UserAgent = val
+		case "output_file":
+			cfg.OutputFile = val
+		case "format":
+			cfg.Format = val
+		case "silent":
+			cfg.Silent, err = strconv.ParseBool(val)
+		case "no_color":
+			cfg.NoColor, err = strconv.ParseBool(val)
+		case "debug":
+			cfg.Debug, err = strconv.ParseBool(val)
+		case "listen":
+			cfg.Listen = val
+		case "rate":
+			cfg.Rate, err = strconv.ParseFloat(val, 64)
+		case "per_host_rate":
+			cfg.PerHostRate, err = strconv.ParseFloat(val, 64)
+		case "delay":
+			cfg.Delay, err = time.ParseDuration(val)
+		case "jitter":
+			cfg.Jitter, err = time.ParseDuration(val)
+		case "max_per_host":
+			cfg.MaxPerHost, err = strconv.Atoi(val)
+		case "retries":
+			cfg.Retries, err = strconv.Atoi(val)
+		case "retry_backoff":
+			cfg.RetryBackoff, err = time.ParseDuration(val)
+		case "retry_max_backoff":
+			cfg.RetryMaxBackoff, err = time.ParseDuration(val)
+		case "http2":
+			cfg.HTTP2, err = strconv.ParseBool(val)
+		}
+		if err != nil {
+			return cfg, keys, fmt.Errorf("invalid value %q for %s", val, name)
+		}
+		keys[key] = true
 	}
 
-	return cfg
+	return cfg, keys, nil
 }
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedtouahria/waf-detector/cli"
+)
+
+func TestResolvePrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	data := []byte(`
+targets:
+  - https://example.com
+threads: 20
+timeout: 15s
+format: json
+delay: 500ms
+rate: 5
+`)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("WAF_DETECTOR_THREADS", "30")
+	t.Setenv("WAF_DETECTOR_RATE", "2.5")
+
+	flags := &cli.Config{
+		ConfigFile: path,
+		Threads:    10,
+		Timeout:    10 * time.Second,
+		Format:     "txt",
+		UserAgent:  "waf-detector/1.0",
+	}
+
+	resolved, err := Resolve(flags)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	cfg := resolved.Config
+	if cfg.Threads != 30 || resolved.Sources["threads"] != SourceEnv {
+		t.Errorf("threads = %d from %s, want 30 from env", cfg.Threads, resolved.Sources["threads"])
+	}
+	if cfg.Timeout != 15*time.Second || resolved.Sources["timeout"] != SourceFile {
+		t.Errorf("timeout = %v from %s, want 15s from file", cfg.Timeout, resolved.Sources["timeout"])
+	}
+	if cfg.Format != "json" {
+		t.Errorf("format = %s, want json", cfg.Format)
+	}
+	if cfg.UserAgent != "waf-detector/1.0" || resolved.Sources["user_agent"] != SourceDefault {
+		t.Errorf("user_agent = %s from %s, want default", cfg.UserAgent, resolved.Sources["user_agent"])
+	}
+	if cfg.Delay != 500*time.Millisecond || cfg.Rate != 2.5 || resolved.Sources["rate"] != SourceEnv {
+		t.Errorf("delay = %v, rate = %v from %s, want 500ms and 2.5 from env", cfg.Delay, cfg.Rate, resolved.Sources["rate"])
+	}
+	if len(cfg.Targets) != 1 || cfg.Targets[0] != "https://example.com" {
+		t.Errorf("targets = %v", cfg.Targets)
+	}
+}
+
+func TestResolveTargetFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	data := []byte(`
+targets:
+  - https://example.com
+list: targets.txt
+`)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantTargets []string
+		wantList    string
+		wantSource  Source
+	}{
+		{"from file", nil, []string{"https://example.com"}, "targets.txt", SourceFile},
+		{"url flag", []string{"-u", "https://other.example"}, nil, "", SourceFlag},
+		{"list flag", []string{"-l", "other.txt"}, nil, "other.txt", SourceFlag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := cli.ParseArgs("waf-detector", append([]string{"-c", path}, tt.args...))
+			resolved, err := Resolve(flags)
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			cfg := resolved.Config
+			if strings.Join(cfg.Targets, ",") != strings.Join(tt.wantTargets, ",") || cfg.ListFile != tt.wantList {
+				t.Errorf("targets = %v, list = %q, want %v and %q", cfg.Targets, cfg.ListFile, tt.wantTargets, tt.wantList)
+			}
+			if resolved.Sources["targets"] != tt.wantSource || resolved.Sources["list"] != tt.wantSource {
+				t.Errorf("sources = %s, %s, want %s", resolved.Sources["targets"], resolved.Sources["list"], tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestResolveSignatures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	data := []byte(`
+signatures:
+  - signatures.d
+  - vendor.yml
+`)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  string
+		want []string
+	}{
+		{"file list", "", []string{"signatures.d", "vendor.yml"}},
+		{"env path list", "a.yml" + string(os.PathListSeparator) + "b", []string{"a.yml", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WAF_DETECTOR_SIGNATURES", tt.env)
+
+			resolved, err := Resolve(&cli.Config{ConfigFile: path})
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			got := resolved.Config.SignaturesFiles
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("signatures = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveListenEnv(t *testing.T) {
+	t.Setenv("WAF_DETECTOR_LISTEN", "127.0.0.1:9090")
+
+	resolved, err := Resolve(&cli.Config{Listen: "127.0.0.1:8080"})
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if resolved.Config.Listen != "127.0.0.1:9090" || resolved.Sources["listen"] != SourceEnv {
+		t.Errorf("listen = %s from %s, want 127.0.0.1:9090 from env", resolved.Config.Listen, resolved.Sources["listen"])
+	}
+}
+
+func TestResolveInvalidEnv(t *testing.T) {
+	t.Setenv("WAF_DETECTOR_THREADS", "many")
+
+	if _, err := Resolve(&cli.Config{}); err == nil {
+		t.Error("Resolve should reject a non-numeric WAF_DETECTOR_THREADS")
+	}
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ahmedtouahria/waf-detector/cli"
+)
+
+// Source identifies where an effective setting came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Resolved is the effective run configuration together with the source of
+// every setting
+type Resolved struct {
+	Config  *cli.Config
+	Sources map[string]Source
+}
+
+// setting ties a config file key to the flags that override it and the
+// cli.Config field it fills
+type setting struct {
+	key   string
+	flags []string
+	apply func(dst *cli.Config, src *FileConfig)
+	value func(cfg *cli.Config) string
+}
+
+// targetFlags give targets on the command line; they replace the targets and
+// list of the config file and environment
+var targetFlags = []string{"u", "url", "l", "list"}
+
+var settings = []setting{
+	{
+		key:   "targets",
+		flags: targetFlags,
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Targets = src.Targets },
+		value: func(cfg *cli.Config) string {
+			targets := cfg.Targets
+			if cfg.URL != "" {
+				targets = append([]string{cfg.URL}, targets...)
+			}
+			return strings.Join(targets, ", ")
+		},
+	},
+	{
+		key:   "list",
+		flags: targetFlags,
+		apply: func(dst *cli.Config, src *FileConfig) { dst.ListFile = src.ListFile },
+		value: func(cfg *cli.Config) string { return cfg.ListFile },
+	},
+	{
+		key:   "signatures",
+		flags: []string{"s", "signatures"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.SignaturesFiles = src.SignaturesFiles },
+		value: func(cfg *cli.Config) string { return strings.Join(cfg.SignaturesFiles, ", ") },
+	},
+	{
+		key:   "threads",
+		flags: []string{"t", "threads"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Threads = src.Threads },
+		value: func(cfg *cli.Config) string { return fmt.Sprint(cfg.Threads) },
+	},
+	{
+		key:   "timeout",
+		flags: []string{"timeout"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Timeout = src.Timeout },
+		value: func(cfg *cli.Config) string { return cfg.Timeout.String() },
+	},
+	{
+		key:   "min_confidence",
+		flags: []string{"min-confidence"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.MinConfidence = src.MinConfidence },
+		value: func(cfg *cli.Config) string { return fmt.Sprint(cfg.MinConfidence) },
+	},
+	{
+		key:   "rate",
+		flags: []string{"rate"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Rate = src.Rate },
+		value: func(cfg *cli.Config) string { return fmt.Sprint(cfg.Rate) },
+	},
+	{
+		key:   "per_host_rate",
+		flags: []string{"per-host-rate"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.PerHostRate = src.PerHostRate },
+		value: func(cfg *cli.Config) string { return fmt.Sprint(cfg.PerHostRate) },
+	},
+	{
+		key:   "delay",
+		flags: []string{"delay"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Delay = src.Delay },
+		value: func(cfg *cli.Config) string { return cfg.Delay.String() },
+	},
+	{
+		key:   "jitter",
+		flags: []string{"jitter"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Jitter = src.Jitter },
+		value: func(cfg *cli.Config) string { return cfg.Jitter.String() },
+	},
+	{
+		key:   "max_per_host",
+		flags: []string{"max-per-host"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.MaxPerHost = src.MaxPerHost },
+		value: func(cfg *cli.Config) string { return fmt.Sprint(cfg.MaxPerHost) },
+	},
+	{
+		key:   "retries",
+		flags: []string{"retries"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Retries = src.Retries },
+		value: func(cfg *cli.Config) string { return fmt.Sprint(cfg.Retries) },
+	},
+	{
+		key:   "retry_backoff",
+		flags: []string{"retry-backoff"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.RetryBackoff = src.RetryBackoff },
+		value: func(cfg *cli.Config) string { return cfg.RetryBackoff.String() },
+	},
+	{
+		key:   "retry_max_backoff",
+		flags: []string{"retry-max-backoff"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.RetryMaxBackoff = src.RetryMaxBackoff },
+		value: func(cfg *cli.Config) string { return cfg.RetryMaxBackoff.String() },
+	},
+	{
+		key:   "http2",
+		flags: []string{"http2"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.HTTP2 = src.HTTP2 },
+		value: func(cfg *cli.Config) string { return fmt.Sprint(cfg.HTTP2) },
+	},
+	{
+		key:   "proxy",
+		flags: []string{"proxy"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Proxy = src.Proxy },
+		value: func(cfg *cli.Config) string { return cfg.Proxy },
+	},
+	{
+		key:   "user_agent",
+		flags: []string{"user-agent"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.UserAgent = src.UserAgent },
+		value: func(cfg *cli.Config) string { return cfg.UserAgent },
+	},
+	{
+		key:   "output_file",
+		flags: []string{"o", "output"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.OutputFile = src.OutputFile },
+		value: func(cfg *cli.Config) string { return cfg.OutputFile },
+	},
+	{
+		key:   "format",
+		flags: []string{"f", "format"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Format = src.Format },
+		value: func(cfg *cli.Config) string { return cfg.Format },
+	},
+	{
+		key:   "silent",
+		flags: []string{"silent"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Silent = src.Silent },
+		value: func(cfg *cli.Config) string { return fmt.Sprint(cfg.Silent) },
+	},
+	{
+		key:   "no_color",
+		flags: []string{"no-color"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.NoColor = src.NoColor },
+		value: func(cfg *cli.Config) string { return fmt.Sprint(cfg.NoColor) },
+	},
+	{
+		key:   "debug",
+		flags: []string{"debug"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Debug = src.Debug },
+		value: func(cfg *cli.Config) string { return fmt.Sprint(cfg.Debug) },
+	},
+	{
+		key:   "listen",
+		flags: []string{"listen"},
+		apply: func(dst *cli.Config, src *FileConfig) { dst.Listen = src.Listen },
+		value: func(cfg *cli.Config) string { return cfg.Listen },
+	},
+}
+
+// Resolve builds the effective configuration from, in increasing order of
+// precedence: flag defaults, the config file named by -c, WAF_DETECTOR_*
+// environment variables and flags set on the command line.
+func Resolve(flags *cli.Config) (*Resolved, error) {
+	cfg := *flags
+
+	fileCfg, fileKeys := &FileConfig{}, map[string]bool{}
+	if flags.ConfigFile != "" {
+		var err error
+		fileCfg, fileKeys, err = loadFile(flags.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	envCfg, envKeys, err := loadEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]Source, len(settings))
+	for _, s := range settings {
+		switch {
+		case len(s.flags) > 0 && flags.IsSet(s.flags...):
+			sources[s.key] = SourceFlag
+		case envKeys[s.key]:
+			s.apply(&cfg, envCfg)
+			sources[s.key] = SourceEnv
+		case fileKeys[s.key]:
+			s.apply(&cfg, fileCfg)
+			sources[s.key] = SourceFile
+		default:
+			sources[s.key] = SourceDefault
+		}
+	}
+
+	return &Resolved{Config: &cfg, Sources: sources}, nil
+}
+
+// Print writes the effective value and source of every setting
+func (r *Resolved) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	if r.Config.ConfigFile != "" {
+		fmt.Fprintf(tw, "# config file: %s\n", r.Config.ConfigFile)
+	}
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	for _, s := range settings {
+		value := s.value(r.Config)
+		if value == "" {
+			value = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.key, value, r.Sources[s.key])
+	}
+
+	return tw.Flush()
+}
@@ -1,40 +1,90 @@
 package detector
 
 import (
-	"strings"
+	"fmt"
+	"sort"
 
 	"github.com/ahmedtouahria/waf-detector/scanner"
 	"github.com/ahmedtouahria/waf-detector/signatures"
 )
 
+// DefaultMinConfidence is the confidence a signature must reach to be reported
+const DefaultMinConfidence = 0.3
+
+// Detection describes the WAF found in front of a target. WAFName, Confidence
+// and Evidence describe the strongest match; Layers lists every match above
+// the detector's threshold, strongest first. Similarity holds the
+// BaselineSimilarity of each probe checked for blocking. Challenged is set
+// when a probe was answered with a challenge page, such as a JavaScript or
+// CAPTCHA check from a bot-management product; ChallengeType and Challenge
+// name its kind and the signature that recognised it. A challenge alone does
+// not set WAFDetected.
 type Detection struct {
-	WAFDetected bool
-	WAFName     string
+	WAFDetected   bool
+	WAFName       string
+	Confidence    float64
+	Details       string
+	Evidence      []signatures.Evidence
+	Layers        []Layer
+	Similarity    map[scanner.ProbeType]float64
+	Challenged    bool
+	ChallengeType signatures.ChallengeType
+	Challenge     string
+}
+
+// Layer is one WAF or CDN product identified in front of a target
+type Layer struct {
+	Name        string
+	Vendor      string
+	Description string
+	Role        signatures.Role
 	Confidence  float64
-	Details     string
+	Evidence    []signatures.Evidence
+}
+
+// Challenge is a challenge page recognised by a challenge signature
+type Challenge struct {
+	Name       string
+	Type       signatures.ChallengeType
+	Confidence float64
+	Evidence   []signatures.Evidence
 }
 
 type Detector struct {
-	signatures []signatures.Signature
+	signatures    []signatures.Signature
+	minConfidence float64
+	policy        signatures.DetectionPolicy
 }
 
 func NewDetector() *Detector {
 	return &Detector{
-		signatures: signatures.GetAllSignatures(),
+		signatures:    signatures.GetAllSignatures(),
+		minConfidence: DefaultMinConfidence,
+		policy:        signatures.DefaultDetectionPolicy(),
 	}
 }
 
 func NewDetectorWithSignatures(sigs []signatures.Signature) *Detector {
 	return &Detector{
-		signatures: sigs,
+		signatures:    sigs,
+		minConfidence: DefaultMinConfidence,
+		policy:        signatures.DefaultDetectionPolicy(),
 	}
 }
 
+// SetMinConfidence sets the confidence a signature must reach to be reported
+// as a layer
+func (d *Detector) SetMinConfidence(minConfidence float64) {
+	d.minConfidence = minConfidence
+}
+
+// SetPolicy sets when probe responses count as WAF behavior
+func (d *Detector) SetPolicy(policy signatures.DetectionPolicy) {
+	d.policy = policy
+}
+
 func (d *Detector) Detect(probes map[scanner.ProbeType]*scanner.ProbeResult) Detection {
 	normal := probes[scanner.ProbeNormal]
-	sqli := probes[scanner.ProbeSQLi]
-	xss := probes[scanner.ProbeXSS]
-	malformed := probes[scanner.ProbeMalformed]
 
 	if normal == nil || normal.Error != nil {
 		return Detection{
@@ -43,95 +93,116 @@ func (d *Detector) Detect(probes map[scanner.ProbeType]*scanner.ProbeResult) Det
 		}
 	}
 
-	wafDetected := d.detectWAFBehavior(normal, sqli, xss, malformed)
+	wafDetected, similarity := d.detectWAFBehavior(probes, normal)
+	layers, challenge := d.fingerprint(probes)
 
+	detection := Detection{Similarity: similarity}
+	if challenge != nil {
+		detection.Challenged = true
+		detection.ChallengeType = challenge.Type
+		detection.Challenge = challenge.Name
+	}
+
+	// A challenge on its own is reported but does not count as a WAF
 	if !wafDetected {
-		return Detection{
-			WAFDetected: false,
-			Details:     "No WAF-like behavior detected",
+		detection.Details = "No WAF-like behavior detected"
+		if detection.Challenged {
+			detection.Details = fmt.Sprintf("No WAF-like behavior detected; %s challenge served (%s)", challenge.Type, challenge.Name)
+			detection.Evidence = challenge.Evidence
 		}
+		return detection
 	}
+	detection.WAFDetected = true
 
-	wafName, confidence := d.fingerprint(probes)
-
-	details := "WAF behavior detected"
-	if wafName != "" {
-		details = "WAF identified based on response patterns"
+	if len(layers) == 0 {
+		detection.WAFName = "Unknown WAF"
+		detection.Details = "WAF behavior detected"
+		if detection.Challenged {
+			detection.Details += fmt.Sprintf("; %s challenge served (%s)", challenge.Type, challenge.Name)
+		}
+		return detection
 	}
 
-	return Detection{
-		WAFDetected: true,
-		WAFName:     wafName,
-		Confidence:  confidence,
-		Details:     details,
+	detection.WAFName = layers[0].Name
+	detection.Confidence = layers[0].Confidence
+	detection.Evidence = layers[0].Evidence
+	detection.Layers = layers
+	detection.Details = "WAF identified based on response patterns"
+	if len(layers) > 1 {
+		detection.Details = fmt.Sprintf("%d stacked WAF/CDN layers identified based on response patterns", len(layers))
+	}
+	if detection.Challenged {
+		detection.Details += fmt.Sprintf("; %s challenge served (%s)", challenge.Type, challenge.Name)
 	}
+	return detection
 }
 
-func (d *Detector) detectWAFBehavior(normal, sqli, xss, malformed *scanner.ProbeResult) bool {
+// detectWAFBehavior reports whether enough of the policy's probes look
+// blocked compared with the normal probe, and how similar each probe's body
+// is to the normal one
+func (d *Detector) detectWAFBehavior(probes map[scanner.ProbeType]*scanner.ProbeResult, normal *scanner.ProbeResult) (bool, map[scanner.ProbeType]float64) {
 	blockingIndicators := 0
+	similarity := make(map[scanner.ProbeType]float64)
 
-	if sqli != nil && sqli.Error == nil {
-		if d.isBlocked(sqli, normal) {
-			blockingIndicators++
+	for _, name := range d.policy.Probes {
+		probeType := scanner.ProbeType(name)
+		probe := probes[probeType]
+		if probe == nil || probe.Error != nil {
+			continue
 		}
-	}
-
-	if xss != nil && xss.Error == nil {
-		if d.isBlocked(xss, normal) {
-			blockingIndicators++
-		}
-	}
-
-	if malformed != nil && malformed.Error == nil {
-		if d.isBlocked(malformed, normal) {
+		similarity[probeType] = signatures.BaselineSimilarity(probe, normal)
+		if d.policy.Blocked(probe, normal) {
 			blockingIndicators++
 		}
 	}
 
-	return blockingIndicators >= 2
+	return blockingIndicators > 0 && blockingIndicators >= d.policy.MinBlockedProbes, similarity
 }
 
-func (d *Detector) isBlocked(probe, baseline *scanner.ProbeResult) bool {
-	if probe.StatusCode == 403 || probe.StatusCode == 406 || probe.StatusCode == 419 || probe.StatusCode == 429 {
-		return true
-	}
+// fingerprint returns every signature that reaches the minimum confidence,
+// ranked strongest first, and the strongest challenge signature if any
+// reaches it
+func (d *Detector) fingerprint(probes map[scanner.ProbeType]*scanner.ProbeResult) ([]Layer, *Challenge) {
+	var layers []Layer
+	var challenge *Challenge
 
-	if probe.StatusCode >= 500 && probe.StatusCode <= 599 && baseline.StatusCode < 400 {
-		return true
-	}
+	for _, sig := range d.signatures {
+		match := sig.Match(probes)
+		if match.Confidence <= 0 || match.Confidence < d.minConfidence {
+			continue
+		}
 
-	if probe.StatusCode != baseline.StatusCode {
-		blockKeywords := []string{
-			"blocked", "forbidden", "access denied", "security",
-			"firewall", "not acceptable", "rejected", "suspicious",
+		var meta signatures.Metadata
+		if describer, ok := sig.(signatures.Describer); ok {
+			meta = describer.Metadata()
 		}
 
-		bodyLower := strings.ToLower(probe.Body)
-		for _, keyword := range blockKeywords {
-			if strings.Contains(bodyLower, keyword) {
-				return true
+		if meta.Challenge != "" {
+			if challenge == nil || match.Confidence > challenge.Confidence {
+				challenge = &Challenge{
+					Name:       sig.Name(),
+					Type:       meta.Challenge,
+					Confidence: match.Confidence,
+					Evidence:   match.Evidence,
+				}
 			}
+			continue
 		}
-	}
-
-	return false
-}
 
-func (d *Detector) fingerprint(probes map[scanner.ProbeType]*scanner.ProbeResult) (string, float64) {
-	var bestMatch string
-	var bestConfidence float64
-
-	for _, sig := range d.signatures {
-		confidence := sig.Match(probes)
-		if confidence > bestConfidence {
-			bestConfidence = confidence
-			bestMatch = sig.Name()
-		}
+		layers = append(layers, Layer{
+			Name:        sig.Name(),
+			Vendor:      meta.Vendor,
+			Description: meta.Description,
+			Role:        signatures.RoleForCategory(meta.Category),
+			Confidence:  match.Confidence,
+			Evidence:    match.Evidence,
+		})
 	}
 
-	if bestConfidence < 0.3 {
-		return "Unknown WAF", 0.0
-	}
+	// Stable so that equally confident signatures keep their file order
+	sort.SliceStable(layers, func(i, j int) bool {
+		return layers[i].Confidence > layers[j].Confidence
+	})
 
-	return bestMatch, bestConfidence
+	return layers, challenge
 }
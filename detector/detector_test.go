@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/ahmedtouahria/waf-detector/scanner"
+	"github.com/ahmedtouahria/waf-detector/signatures"
 )
 
 func TestNewDetector(t *testing.T) {
@@ -100,3 +101,223 @@ func TestDetectWAFBehaviorStatusCodeChange(t *testing.T) {
 		t.Error("Should detect WAF behavior with status code change")
 	}
 }
+
+func TestDetectStackedLayers(t *testing.T) {
+	d := NewDetector()
+	edge := map[string][]string{
+		"Cf-Ray":          {"7d1f3a2b9c0e4f21-CDG"},
+		"Cf-Cache-Status": {"DYNAMIC"},
+		"Server":          {"cloudflare"},
+	}
+	probes := map[scanner.ProbeType]*scanner.ProbeResult{
+		scanner.ProbeNormal: {StatusCode: 200, Headers: edge, Body: "Welcome"},
+		scanner.ProbeSQLi: {
+			StatusCode: 406,
+			Headers:    edge,
+			Body:       "<h1>Not Acceptable!</h1> This error was generated by Mod_Security. Reference ID: 1234",
+		},
+		scanner.ProbeXSS: {
+			StatusCode: 406,
+			Headers:    edge,
+			Body:       "<h1>Not Acceptable!</h1> This error was generated by Mod_Security.",
+		},
+	}
+
+	result := d.Detect(probes)
+	if !result.WAFDetected {
+		t.Fatal("Should detect WAF behavior")
+	}
+
+	roles := make(map[string]string)
+	for i, layer := range result.Layers {
+		roles[layer.Name] = string(layer.Role)
+		if i > 0 && layer.Confidence > result.Layers[i-1].Confidence {
+			t.Errorf("Layers not ranked by confidence: %+v", result.Layers)
+		}
+	}
+
+	if roles["Cloudflare"] != "cloud-waf" {
+		t.Errorf("Cloudflare layer role = %q, want cloud-waf (layers: %v)", roles["Cloudflare"], roles)
+	}
+	if roles["ModSecurity"] != "on-prem-appliance" {
+		t.Errorf("ModSecurity layer role = %q, want on-prem-appliance (layers: %v)", roles["ModSecurity"], roles)
+	}
+	if result.WAFName != result.Layers[0].Name {
+		t.Errorf("WAFName = %s, want strongest layer %s", result.WAFName, result.Layers[0].Name)
+	}
+
+	d.SetMinConfidence(1.1)
+	if result := d.Detect(probes); len(result.Layers) != 0 || result.WAFName != "Unknown WAF" {
+		t.Errorf("No layer should pass a threshold above 1, got %+v", result.Layers)
+	}
+}
+
+func TestDetectWithPolicy(t *testing.T) {
+	welcome := &scanner.ProbeResult{StatusCode: 200, Headers: map[string][]string{}, Body: "Welcome"}
+	challenge := &scanner.ProbeResult{StatusCode: 200, Headers: map[string][]string{}, Body: "<h1>Checking your browser</h1>"}
+	redirect := &scanner.ProbeResult{StatusCode: 302, Headers: map[string][]string{"Location": {"/waf/blocked.html"}}}
+	off := 0.0
+	noSimilarity := signatures.DefaultDetectionPolicy()
+	noSimilarity.MinSimilarity = &off
+
+	tests := []struct {
+		name   string
+		policy signatures.DetectionPolicy
+		probes map[scanner.ProbeType]*scanner.ProbeResult
+		want   bool
+	}{
+		{
+			name:   "challenge page diverges from the baseline",
+			policy: signatures.DefaultDetectionPolicy(),
+			probes: map[scanner.ProbeType]*scanner.ProbeResult{
+				scanner.ProbeNormal: welcome, scanner.ProbeSQLi: challenge, scanner.ProbeXSS: challenge,
+			},
+			want: true,
+		},
+		{
+			name:   "challenge page with similarity off",
+			policy: noSimilarity,
+			probes: map[scanner.ProbeType]*scanner.ProbeResult{
+				scanner.ProbeNormal: welcome, scanner.ProbeSQLi: challenge, scanner.ProbeXSS: challenge,
+			},
+		},
+		{
+			name: "200 challenge page",
+			policy: signatures.DetectionPolicy{
+				Probes:           []string{"sqli", "xss"},
+				MinBlockedProbes: 2,
+				Keywords:         []string{"checking your browser"},
+				KeywordBaseline:  signatures.KeywordBaselineBody,
+			},
+			probes: map[scanner.ProbeType]*scanner.ProbeResult{
+				scanner.ProbeNormal: welcome, scanner.ProbeSQLi: challenge, scanner.ProbeXSS: challenge,
+			},
+			want: true,
+		},
+		{
+			name: "one redirect is enough",
+			policy: signatures.DetectionPolicy{
+				Probes:           []string{"sqli", "xss", "malformed"},
+				MinBlockedProbes: 1,
+				BlockRedirects:   []string{"/waf/blocked"},
+			},
+			probes: map[scanner.ProbeType]*scanner.ProbeResult{
+				scanner.ProbeNormal: welcome, scanner.ProbeSQLi: redirect, scanner.ProbeXSS: welcome,
+			},
+			want: true,
+		},
+		{
+			name: "custom probe",
+			policy: signatures.DetectionPolicy{
+				Probes:           []string{"graphql"},
+				MinBlockedProbes: 1,
+				BlockStatusCodes: []int{403},
+			},
+			probes: map[scanner.ProbeType]*scanner.ProbeResult{
+				scanner.ProbeNormal: welcome,
+				scanner.ProbeSQLi:   {StatusCode: 403, Headers: map[string][]string{}},
+				"graphql":           {StatusCode: 403, Headers: map[string][]string{}},
+			},
+			want: true,
+		},
+		{
+			name: "probe outside the policy",
+			policy: signatures.DetectionPolicy{
+				Probes:           []string{"graphql"},
+				MinBlockedProbes: 1,
+				BlockStatusCodes: []int{403},
+			},
+			probes: map[scanner.ProbeType]*scanner.ProbeResult{
+				scanner.ProbeNormal: welcome,
+				scanner.ProbeSQLi:   {StatusCode: 403, Headers: map[string][]string{}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector()
+			d.SetPolicy(tt.policy)
+			if got := d.Detect(tt.probes).WAFDetected; got != tt.want {
+				t.Errorf("WAFDetected = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectChallenge(t *testing.T) {
+	page := func(status int, headers map[string][]string, body string) *scanner.ProbeResult {
+		if headers == nil {
+			headers = map[string][]string{}
+		}
+		return &scanner.ProbeResult{StatusCode: status, Headers: headers, Body: body}
+	}
+	welcome := page(200, nil, "<html><h1>Welcome to the shop</h1></html>")
+	managed := page(403, map[string][]string{"Server": {"cloudflare"}, "Cf-Ray": {"8a2c1f4e9b3d7a10-FRA"}, "Cf-Mitigated": {"challenge"}},
+		`<html><head><title>Just a moment...</title></head><body><script src="/cdn-cgi/challenge-platform/h/g/orchestrate/chl_page/v1"></script></body></html>`)
+	hcaptcha := page(200, nil, `<html><body><div class="h-captcha" data-sitekey="x"></div><script src="https://js.hcaptcha.com/1/api.js"></script></body></html>`)
+
+	tests := []struct {
+		name          string
+		probes        map[scanner.ProbeType]*scanner.ProbeResult
+		wantChallenge string
+		wantType      signatures.ChallengeType
+		wantDetected  bool
+		wantWAF       string
+	}{
+		{
+			name: "every request challenged",
+			probes: map[scanner.ProbeType]*scanner.ProbeResult{
+				scanner.ProbeNormal: managed, scanner.ProbeSQLi: managed, scanner.ProbeXSS: managed, scanner.ProbeMalformed: managed,
+			},
+			wantChallenge: "Cloudflare Managed Challenge",
+			wantType:      signatures.ChallengeJavaScript,
+			wantDetected:  true,
+			wantWAF:       "Cloudflare",
+		},
+		{
+			name: "captcha for attack probes only",
+			probes: map[scanner.ProbeType]*scanner.ProbeResult{
+				scanner.ProbeNormal: welcome, scanner.ProbeSQLi: welcome, scanner.ProbeXSS: hcaptcha, scanner.ProbeMalformed: welcome,
+			},
+			wantChallenge: "CAPTCHA Widget",
+			wantType:      signatures.ChallengeCAPTCHA,
+		},
+		{
+			name: "captcha with blocked attack probes",
+			probes: map[scanner.ProbeType]*scanner.ProbeResult{
+				scanner.ProbeNormal: welcome, scanner.ProbeSQLi: page(403, nil, "Forbidden"), scanner.ProbeXSS: hcaptcha, scanner.ProbeMalformed: welcome,
+			},
+			wantChallenge: "CAPTCHA Widget",
+			wantType:      signatures.ChallengeCAPTCHA,
+			wantDetected:  true,
+			wantWAF:       "Unknown WAF",
+		},
+		{
+			name: "not challenged",
+			probes: map[scanner.ProbeType]*scanner.ProbeResult{
+				scanner.ProbeNormal: welcome, scanner.ProbeSQLi: welcome, scanner.ProbeXSS: welcome, scanner.ProbeMalformed: welcome,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewDetector().Detect(tt.probes)
+			if result.Challenged != (tt.wantChallenge != "") || result.Challenge != tt.wantChallenge || result.ChallengeType != tt.wantType {
+				t.Errorf("challenge = %v %q (%s), want %q (%s)", result.Challenged, result.Challenge, result.ChallengeType, tt.wantChallenge, tt.wantType)
+			}
+			if result.WAFDetected != tt.wantDetected {
+				t.Errorf("WAFDetected = %v, want %v", result.WAFDetected, tt.wantDetected)
+			}
+			if result.WAFName != tt.wantWAF {
+				t.Errorf("WAFName = %q, want %q", result.WAFName, tt.wantWAF)
+			}
+			for _, layer := range result.Layers {
+				if layer.Name == tt.wantChallenge {
+					t.Errorf("challenge %q reported as a layer", layer.Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ahmedtouahria/waf-detector/emulator"
+	"github.com/ahmedtouahria/waf-detector/signatures/fixtures"
+)
+
+const emulateUsage = `Usage:
+  waf-detector emulate [-addr host:port] [-vendor name] [-fixtures path] [-list]
+
+Serves recorded WAF responses from the signature fixtures for offline scans.
+Each vendor is served under /<vendor>/, or on every path with -vendor.
+
+Options:
+`
+
+const emulateExamples = `
+Examples:
+  waf-detector emulate &
+  waf-detector -u http://127.0.0.1:8081/cloudflare/
+  waf-detector emulate -vendor f5-bigip -addr 127.0.0.1:9000
+`
+
+// runEmulate serves the fixtures until interrupted
+func runEmulate(args []string) {
+	fs := flag.NewFlagSet("waf-detector emulate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, emulateUsage)
+		fs.PrintDefaults()
+		fmt.Fprint(os.Stderr, emulateExamples)
+	}
+	addr := fs.String("addr", "127.0.0.1:8081", "Address to listen on")
+	vendor := fs.String("vendor", "", "Answer every path like this vendor")
+	path := fs.String("fixtures", "", "Fixture file or directory (default: the embedded fixtures)")
+	list := fs.Bool("list", false, "List the vendors and exit")
+	_ = fs.Parse(args)
+
+	var all []fixtures.Fixture
+	var err error
+	if *path != "" {
+		all, err = fixtures.Load(*path)
+	} else {
+		all, err = fixtures.Embedded()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	emu, err := emulator.New(all)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *list {
+		for _, name := range emu.Vendors() {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	var handler http.Handler = emu
+	if *vendor != "" {
+		if handler = emu.Vendor(*vendor); handler == nil {
+			fmt.Fprintf(os.Stderr, "unknown vendor %q; run waf-detector emulate -list\n", *vendor)
+			os.Exit(2)
+		}
+	}
+
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(ctx)
+	}()
+
+	if *vendor != "" {
+		fmt.Fprintf(os.Stderr, "Emulating %s on http://%s/\n", *vendor, *addr)
+	} else {
+		fmt.Fprintf(os.Stderr, "Emulating %d vendors on http://%s/<vendor>/\n", len(emu.Vendors()), *addr)
+	}
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error starting emulator: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,165 @@
+// Package emulator serves recorded WAF responses from signature fixtures, so
+// that scans can run end to end without network access: in CI, in tests and
+// in demos.
+//
+// Every fixture is a vendor named after its file, such as cloudflare for
+// cloudflare.yml. Requests are classified as one of the built-in probes and
+// answered with the fixture's response to that probe:
+//
+//	emu, err := emulator.New(all)
+//	...
+//	srv := httptest.NewServer(emu)              // /cloudflare/, /imperva/, ...
+//	srv := httptest.NewServer(emu.Vendor("f5-bigip")) // every path
+package emulator
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ahmedtouahria/waf-detector/scanner"
+	"github.com/ahmedtouahria/waf-detector/signatures/fixtures"
+)
+
+// Emulator serves fixtures by vendor. As an http.Handler it selects the
+// vendor by the first path segment.
+type Emulator struct {
+	vendors map[string]fixtures.Fixture
+	names   []string
+}
+
+// skippedHeaders are recorded headers that would conflict with the body the
+// emulator writes
+var skippedHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+}
+
+// New creates an emulator serving the given fixtures
+func New(all []fixtures.Fixture) (*Emulator, error) {
+	e := &Emulator{vendors: make(map[string]fixtures.Fixture, len(all))}
+	for _, f := range all {
+		name := VendorName(f)
+		if _, ok := e.vendors[name]; ok {
+			return nil, fmt.Errorf("duplicate vendor %q", name)
+		}
+		e.vendors[name] = f
+		e.names = append(e.names, name)
+	}
+	sort.Strings(e.names)
+	return e, nil
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// VendorName is the name a fixture is served under: its file name without
+// the extension, or its name in lower case with dashes when it has no file
+func VendorName(f fixtures.Fixture) string {
+	if f.Path != "" {
+		base := path.Base(strings.ReplaceAll(f.Path, "\\", "/"))
+		return strings.TrimSuffix(base, path.Ext(base))
+	}
+	return strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(f.Name), "-"), "-")
+}
+
+// Vendors returns the vendor names, sorted
+func (e *Emulator) Vendors() []string {
+	return e.names
+}
+
+// Vendor returns a handler that answers every path like the named vendor, or
+// nil if there is no such vendor
+func (e *Emulator) Vendor(name string) http.Handler {
+	f, ok := e.vendors[name]
+	if !ok {
+		return nil
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, f)
+	})
+}
+
+// ServeHTTP answers /<vendor>/... like that vendor and lists the vendors on
+// any other path
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vendor := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+	if f, ok := e.vendors[vendor]; ok {
+		serve(w, r, f)
+		return
+	}
+
+	status := http.StatusOK
+	if r.URL.Path != "/" {
+		status = http.StatusNotFound
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, "waf-detector emulator; scan one of:")
+	for _, name := range e.names {
+		fmt.Fprintf(w, "  /%s/  %s\n", name, e.vendors[name].Name)
+	}
+}
+
+// serve writes the fixture's response to the probe r was classified as
+func serve(w http.ResponseWriter, r *http.Request, f fixtures.Fixture) {
+	response := Response(f, Classify(r))
+	for key, values := range response.Headers {
+		if skippedHeaders[http.CanonicalHeaderKey(key)] {
+			continue
+		}
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(response.Status)
+	if r.Method != http.MethodHead {
+		fmt.Fprint(w, response.Body)
+	}
+}
+
+// Response returns the fixture's response to probe. An attack probe the
+// fixture did not record gets the response to another attack probe, since a
+// WAF that blocks one payload usually blocks the others, and otherwise the
+// normal response.
+func Response(f fixtures.Fixture, probe scanner.ProbeType) fixtures.Response {
+	if response, ok := f.Probes[string(probe)]; ok {
+		return response
+	}
+	if probe != scanner.ProbeNormal {
+		for _, attack := range scanner.BuiltinProbeTypes()[1:] {
+			if response, ok := f.Probes[string(attack)]; ok {
+				return response
+			}
+		}
+	}
+	return f.Probes[string(scanner.ProbeNormal)]
+}
+
+// Classify returns the built-in probe a request was sent by, recognised by
+// the payloads the scanner uses. Other requests are normal.
+func Classify(r *http.Request) scanner.ProbeType {
+	query := strings.ToLower(strings.Join(queryValues(r), " "))
+	switch {
+	case strings.Contains(query, "<script") || strings.Contains(query, "onerror="):
+		return scanner.ProbeXSS
+	case strings.Contains(query, "' or '") || strings.Contains(query, "union select"):
+		return scanner.ProbeSQLi
+	case strings.Contains(r.UserAgent(), "../") ||
+		strings.HasPrefix(r.Referer(), "javascript:") ||
+		strings.Contains(r.Header.Get("X-Forwarded-For"), "'"):
+		return scanner.ProbeMalformed
+	}
+	return scanner.ProbeNormal
+}
+
+func queryValues(r *http.Request) []string {
+	var values []string
+	for _, v := range r.URL.Query() {
+		values = append(values, v...)
+	}
+	return values
+}
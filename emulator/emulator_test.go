@@ -0,0 +1,171 @@
+package emulator
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedtouahria/waf-detector/scanner"
+	"github.com/ahmedtouahria/waf-detector/signatures/fixtures"
+	"github.com/ahmedtouahria/waf-detector/wafdetector"
+)
+
+func newEmulator(t *testing.T) *Emulator {
+	t.Helper()
+	all, err := fixtures.Embedded()
+	if err != nil {
+		t.Fatalf("Embedded() error = %v", err)
+	}
+	emu, err := New(all)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return emu
+}
+
+func TestClassify(t *testing.T) {
+	// Classify the requests the scanner actually sends, so the emulator
+	// notices when the probe payloads change
+	var got []scanner.ProbeType
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, Classify(r))
+	}))
+	defer srv.Close()
+
+	s := scanner.New(scanner.Options{Timeout: 5 * time.Second})
+	if _, err := s.Scan(context.Background(), srv.URL); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	want := scanner.BuiltinProbeTypes()
+	if len(got) != len(want) {
+		t.Fatalf("Classify() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d classified as %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestScanVendors(t *testing.T) {
+	srv := httptest.NewServer(newEmulator(t))
+	defer srv.Close()
+
+	client, err := wafdetector.New(wafdetector.WithTimeout(5 * time.Second))
+	if err != nil {
+		t.Fatalf("wafdetector.New() error = %v", err)
+	}
+
+	tests := []struct {
+		vendor string
+		want   string
+	}{
+		{"cloudflare", "Cloudflare"},
+		{"imperva", "Imperva Incapsula"},
+		{"f5-bigip", "F5 BIG-IP"},
+		{"modsecurity", "ModSecurity"},
+		{"no-waf", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.vendor, func(t *testing.T) {
+			result, err := client.Detect(context.Background(), srv.URL+"/"+tt.vendor+"/")
+			if err != nil {
+				t.Fatalf("Detect() error = %v", err)
+			}
+			if tt.want == "" {
+				if result.WAFFound {
+					t.Errorf("Detect() found %s, want no WAF", result.WAFName)
+				}
+				return
+			}
+			if !result.WAFFound || result.WAFName != tt.want {
+				t.Errorf("Detect() = %q (found=%v, %s), want %s", result.WAFName, result.WAFFound, result.Details, tt.want)
+			}
+		})
+	}
+}
+
+func TestVendor(t *testing.T) {
+	emu := newEmulator(t)
+	if emu.Vendor("missing") != nil {
+		t.Error("Vendor() of an unknown vendor should be nil")
+	}
+
+	srv := httptest.NewServer(emu.Vendor("modsecurity"))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/any/path?id=1'+OR+'1'='1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotAcceptable {
+		t.Errorf("status = %d, want 406", resp.StatusCode)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	srv := httptest.NewServer(newEmulator(t))
+	defer srv.Close()
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/", http.StatusOK},
+		{"/unknown/", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status || !strings.Contains(string(body), "/cloudflare/") {
+				t.Errorf("GET %s = %d %q, want %d with the vendor list", tt.path, resp.StatusCode, body, tt.status)
+			}
+		})
+	}
+}
+
+func TestResponse(t *testing.T) {
+	f := fixtures.Fixture{Probes: map[string]fixtures.Response{
+		"normal": {Status: 200},
+		"xss":    {Status: 403},
+	}}
+
+	tests := []struct {
+		probe scanner.ProbeType
+		want  int
+	}{
+		{scanner.ProbeNormal, 200},
+		{scanner.ProbeXSS, 403},
+		{scanner.ProbeSQLi, 403},
+		{scanner.ProbeMalformed, 403},
+	}
+
+	for _, tt := range tests {
+		if got := Response(f, tt.probe).Status; got != tt.want {
+			t.Errorf("Response(%s) status = %d, want %d", tt.probe, got, tt.want)
+		}
+	}
+}
+
+func TestNewDuplicateVendor(t *testing.T) {
+	f := fixtures.Fixture{Name: "Example", Path: "a/example.yml"}
+	if _, err := New([]fixtures.Fixture{f, {Name: "Example WAF", Path: "b/example.yml"}}); err == nil {
+		t.Error("New() should reject two fixtures served as the same vendor")
+	}
+	if name := VendorName(fixtures.Fixture{Name: "Cloudflare block page"}); name != "cloudflare-block-page" {
+		t.Errorf("VendorName() = %q, want cloudflare-block-page", name)
+	}
+}
@@ -1,7 +1,16 @@
 package errors
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
 )
 
 // ErrorType represents the type of error
@@ -13,6 +22,12 @@ const (
 	ErrorTypeInvalidURL ErrorType = "INVALID_URL"
 	ErrorTypeParsing    ErrorType = "PARSING"
 	ErrorTypeUnknown    ErrorType = "UNKNOWN"
+
+	ErrorTypeDNS               ErrorType = "DNS"
+	ErrorTypeConnectionRefused ErrorType = "CONNECTION_REFUSED"
+	ErrorTypeConnectionReset   ErrorType = "CONNECTION_RESET"
+	ErrorTypeTLS               ErrorType = "TLS"
+	ErrorTypeCanceled          ErrorType = "CANCELED"
 )
 
 // WAFError represents a custom error for WAF detection
@@ -21,6 +36,8 @@ type WAFError struct {
 	URL     string
 	Message string
 	Err     error
+	// Transient is set for failures that may succeed when retried
+	Transient bool
 }
 
 func (e *WAFError) Error() string {
@@ -82,3 +99,158 @@ func NewUnknownError(url string, err error) *WAFError {
 		Err:     err,
 	}
 }
+
+// NewDNSError creates a new DNS lookup error. Temporary failures and lookup
+// timeouts are transient; unknown hosts are not.
+func NewDNSError(url string, err error) *WAFError {
+	transient := false
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		transient = dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	return &WAFError{
+		Type:      ErrorTypeDNS,
+		URL:       url,
+		Message:   "DNS lookup failed",
+		Err:       err,
+		Transient: transient,
+	}
+}
+
+// NewConnectionRefusedError creates a new connection refused error
+func NewConnectionRefusedError(url string, err error) *WAFError {
+	return &WAFError{
+		Type:    ErrorTypeConnectionRefused,
+		URL:     url,
+		Message: "Connection refused",
+		Err:     err,
+	}
+}
+
+// NewConnectionResetError creates a new error for a connection closed by
+// the peer
+func NewConnectionResetError(url string, err error) *WAFError {
+	return &WAFError{
+		Type:      ErrorTypeConnectionReset,
+		URL:       url,
+		Message:   "Connection reset",
+		Err:       err,
+		Transient: true,
+	}
+}
+
+// NewTLSError creates a new TLS handshake error
+func NewTLSError(url string, err error) *WAFError {
+	return &WAFError{
+		Type:    ErrorTypeTLS,
+		URL:     url,
+		Message: "TLS handshake failed",
+		Err:     err,
+	}
+}
+
+// NewCanceledError creates a new error for a scan that was stopped
+func NewCanceledError(url string, err error) *WAFError {
+	return &WAFError{
+		Type:    ErrorTypeCanceled,
+		URL:     url,
+		Message: "Scan canceled",
+		Err:     err,
+	}
+}
+
+// Classify wraps err in a WAFError describing why a request to url failed.
+// Errors that already are WAFErrors are returned unchanged.
+func Classify(url string, err error) *WAFError {
+	if err == nil {
+		return nil
+	}
+
+	var wafErr *WAFError
+	if errors.As(err, &wafErr) {
+		return wafErr
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return NewDNSError(url, err)
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return NewCanceledError(url, err)
+	case isTimeout(err):
+		timeout := NewTimeoutError(url)
+		timeout.Err = err
+		timeout.Transient = true
+		return timeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return NewConnectionRefusedError(url, err)
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return NewConnectionResetError(url, err)
+	case isTLS(err):
+		return NewTLSError(url, err)
+	case isInvalidURL(err):
+		return NewInvalidURLError(url, err)
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return NewNetworkError(url, err)
+	}
+	return NewUnknownError(url, err)
+}
+
+// IsTransient reports whether err is a failure that may succeed when retried
+func IsTransient(err error) bool {
+	var wafErr *WAFError
+	if errors.As(err, &wafErr) {
+		return wafErr.Transient
+	}
+	return err != nil && Classify("", err).Transient
+}
+
+// TypeOf returns the type of err, or "" when err is nil
+func TypeOf(err error) ErrorType {
+	if err == nil {
+		return ""
+	}
+	return Classify("", err).Type
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isTLS(err error) bool {
+	var (
+		recordErr      tls.RecordHeaderError
+		alertErr       tls.AlertError
+		verifyErr      *tls.CertificateVerificationError
+		authorityErr   x509.UnknownAuthorityError
+		hostnameErr    x509.HostnameError
+		certInvalidErr x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &certInvalidErr) {
+		return true
+	}
+	// Handshake failures are mostly plain errors prefixed "tls: ", and
+	// net/http reports a plain HTTP server on an https URL as its own error
+	msg := err.Error()
+	return strings.Contains(msg, "tls: ") || strings.Contains(msg, "server gave HTTP response to HTTPS client")
+}
+
+func isInvalidURL(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.Op == "parse" {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "unsupported protocol scheme") || strings.Contains(msg, "no Host in request URL")
+}
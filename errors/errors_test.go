@@ -1,8 +1,20 @@
 package errors
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestWAFError(t *testing.T) {
@@ -48,3 +60,83 @@ func TestErrorUnwrap(t *testing.T) {
 		t.Errorf("Unwrap() = %v, want %v", unwrapped, originalErr)
 	}
 }
+
+func TestClassify(t *testing.T) {
+	const target = "https://example.com"
+	opErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: target, Err: &net.OpError{Op: "dial", Net: "tcp", Err: err}}
+	}
+
+	tests := []struct {
+		name          string
+		err           error
+		wantType      ErrorType
+		wantTransient bool
+	}{
+		{"unknown host", opErr(&net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}), ErrorTypeDNS, false},
+		{"temporary DNS failure", opErr(&net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}), ErrorTypeDNS, true},
+		{"connection refused", opErr(os.NewSyscallError("connect", syscall.ECONNREFUSED)), ErrorTypeConnectionRefused, false},
+		{"connection reset", opErr(os.NewSyscallError("read", syscall.ECONNRESET)), ErrorTypeConnectionReset, true},
+		{"closed by peer", &url.Error{Op: "Get", URL: target, Err: io.EOF}, ErrorTypeConnectionReset, true},
+		{"deadline", &url.Error{Op: "Get", URL: target, Err: context.DeadlineExceeded}, ErrorTypeTimeout, true},
+		{"canceled", &url.Error{Op: "Get", URL: target, Err: context.Canceled}, ErrorTypeCanceled, false},
+		{"TLS record", &url.Error{Op: "Get", URL: target, Err: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}}, ErrorTypeTLS, false},
+		{"TLS certificate", &url.Error{Op: "Get", URL: target, Err: x509.UnknownAuthorityError{}}, ErrorTypeTLS, false},
+		{"TLS alert", &url.Error{Op: "Get", URL: target, Err: errors.New("remote error: tls: handshake failure")}, ErrorTypeTLS, false},
+		{"invalid URL", &url.Error{Op: "parse", URL: "http://[::1", Err: errors.New("missing ']' in host")}, ErrorTypeInvalidURL, false},
+		{"unsupported scheme", &url.Error{Op: "Get", URL: "ftp://example.com", Err: errors.New("unsupported protocol scheme \"ftp\"")}, ErrorTypeInvalidURL, false},
+		{"other network error", opErr(errors.New("network is unreachable")), ErrorTypeNetwork, false},
+		{"other error", errors.New("something else"), ErrorTypeUnknown, false},
+		{"already classified", NewConnectionResetError(target, io.EOF), ErrorTypeConnectionReset, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify(target, tt.err)
+			if got.Type != tt.wantType || got.Transient != tt.wantTransient {
+				t.Errorf("Classify() = %s (transient=%v), want %s (transient=%v)", got.Type, got.Transient, tt.wantType, tt.wantTransient)
+			}
+			if !errors.Is(got, tt.err) && got != tt.err {
+				t.Error("Classify() should wrap the original error")
+			}
+			if IsTransient(tt.err) != tt.wantTransient || TypeOf(tt.err) != tt.wantType {
+				t.Errorf("IsTransient() = %v, TypeOf() = %s", IsTransient(tt.err), TypeOf(tt.err))
+			}
+		})
+	}
+
+	if Classify(target, nil) != nil || TypeOf(nil) != "" || IsTransient(nil) {
+		t.Error("a nil error should not be classified")
+	}
+}
+
+func TestClassifyRequests(t *testing.T) {
+	// A closed server leaves a port that refuses connections
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		wantType ErrorType
+	}{
+		{"refused", closed.URL, ErrorTypeConnectionRefused},
+		{"https to a plain HTTP server", strings.Replace(plain.URL, "http://", "https://", 1), ErrorTypeTLS},
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(tt.url)
+			if err == nil {
+				resp.Body.Close()
+				t.Fatal("expected the request to fail")
+			}
+			if got := TypeOf(err); got != tt.wantType {
+				t.Errorf("TypeOf(%v) = %s, want %s", err, got, tt.wantType)
+			}
+		})
+	}
+}
@@ -6,21 +6,38 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"sync"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/ahmedtouahria/waf-detector/cassette"
+	"github.com/ahmedtouahria/waf-detector/checkpoint"
 	"github.com/ahmedtouahria/waf-detector/cli"
-	"github.com/ahmedtouahria/waf-detector/detector"
+	"github.com/ahmedtouahria/waf-detector/config"
 	"github.com/ahmedtouahria/waf-detector/logger"
 	"github.com/ahmedtouahria/waf-detector/output"
 	"github.com/ahmedtouahria/waf-detector/scanner"
 	"github.com/ahmedtouahria/waf-detector/signatures"
+	"github.com/ahmedtouahria/waf-detector/wafdetector"
 	"github.com/schollz/progressbar/v3"
 )
 
 func main() {
-	config := cli.ParseFlags()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "sigs":
+			runSigs(os.Args[2:])
+			return
+		case "emulate":
+			runEmulate(os.Args[2:])
+			return
+		}
+	}
+
+	config := loadConfig(cli.ParseFlags())
 
 	if config.ShowVersion {
 		fmt.Printf("waf-detector version %s\n", Version)
@@ -37,9 +54,20 @@ func main() {
 		logger.Debugf("Config: %+v", config)
 	}
 
-	targets := collectTargets(config)
-	if len(targets) == 0 {
-		logger.Fatal("No targets specified. Use -u or -l")
+	state := openState(config)
+	if state != nil {
+		defer state.Close()
+	}
+
+	total, err := countTargets(config, state)
+	if err != nil {
+		logger.Fatalf("Error reading targets: %v", err)
+	}
+	if total == 0 && (state == nil || state.Previous() == 0) {
+		logger.Fatal("No targets specified. Use -u, -l, targets in the config file or --replay")
+	}
+	if config.ListFile != "" {
+		logger.Infof("Loaded %d targets", total)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -55,76 +83,189 @@ func main() {
 		cancel()
 	}()
 
-	results := processTargets(ctx, targets, config)
-
-	if err := output.WriteResults(results, config); err != nil {
+	w, err := output.NewResultWriter(config)
+	if err != nil {
 		logger.Fatalf("Error writing output: %v", err)
 	}
+
+	targets, readErr := streamTargets(ctx, config, state)
+	writeErr := processTargets(ctx, targets, total, config, w, state)
+	// Release the target reader if scanning stopped early
+	cancel()
+
+	if err := w.Close(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if writeErr != nil {
+		logger.Fatalf("Error writing output: %v", writeErr)
+	}
+	if err := <-readErr; err != nil {
+		logger.Fatalf("Error reading targets: %v", err)
+	}
 }
 
-func collectTargets(config *cli.Config) []string {
-	var targets []string
+// loadConfig resolves parsed flags against the config file and environment.
+// With --print-config it reports the result and exits.
+func loadConfig(flags *cli.Config) *cli.Config {
+	resolved, err := config.Resolve(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	if config.URL != "" {
-		targets = append(targets, config.URL)
+	if err := resolved.Config.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	if config.ListFile != "" {
-		file, err := os.Open(config.ListFile)
-		if err != nil {
-			logger.Fatalf("Error opening list file: %v", err)
+	if resolved.Config.PrintConfig {
+		if err := resolved.Print(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
-		defer file.Close()
+		os.Exit(0)
+	}
 
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line != "" {
-				targets = append(targets, line)
-			}
+	return resolved.Config
+}
+
+// openState opens the --resume state file, if any
+func openState(config *cli.Config) *checkpoint.State {
+	if config.ResumeFile == "" {
+		return nil
+	}
+
+	opts, err := checkpoint.OptionsFromConfig(config)
+	if err != nil {
+		logger.Fatalf("Error opening state file: %v", err)
+	}
+	state, err := checkpoint.Open(config.ResumeFile, opts)
+	if err != nil {
+		logger.Fatalf("Error opening state file: %v", err)
+	}
+	if state.Previous() > 0 {
+		logger.Infof("Resuming from %s: %d targets already scanned", config.ResumeFile, state.Previous())
+	}
+	return state
+}
+
+// forEachTarget calls fn for every target from flags, the config file and
+// the list file until fn returns false, skipping targets already recorded in
+// state. The list file is read lazily. When replaying without targets, every
+// recorded target is visited.
+func forEachTarget(config *cli.Config, state *checkpoint.State, fn func(target string) bool) error {
+	visit := func(target string) bool {
+		if state != nil && state.Done(target) {
+			return true
 		}
+		return fn(target)
+	}
 
-		if err := scanner.Err(); err != nil {
-			logger.Fatalf("Error reading list file: %v", err)
+	if config.URL != "" && !visit(config.URL) {
+		return nil
+	}
+	for _, target := range config.Targets {
+		if !visit(target) {
+			return nil
 		}
+	}
+	if config.ListFile != "" {
+		return readListFile(config.ListFile, visit)
+	}
 
-		logger.Infof("Loaded %d targets from file", len(targets))
+	// Without targets, a replay covers every recorded target
+	if config.ReplayDir != "" && config.URL == "" && len(config.Targets) == 0 {
+		player, err := cassette.NewPlayer(config.ReplayDir)
+		if err != nil {
+			return err
+		}
+		return player.Targets(visit)
 	}
+	return nil
+}
 
-	return targets
+// countTargets counts the targets left to scan without keeping them in memory
+func countTargets(config *cli.Config, state *checkpoint.State) (int, error) {
+	total := 0
+	err := forEachTarget(config, state, func(string) bool {
+		total++
+		return true
+	})
+	return total, err
 }
 
-func processTargets(ctx context.Context, targets []string, config *cli.Config) []output.Result {
-	var (
-		wg      sync.WaitGroup
-		mu      sync.Mutex
-		results []output.Result
-	)
+// streamTargets feeds the targets left to scan. The error channel yields the
+// outcome of reading once the targets channel is closed.
+func streamTargets(ctx context.Context, config *cli.Config, state *checkpoint.State) (<-chan string, <-chan error) {
+	targets := make(chan string)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(targets)
+
+		errc <- forEachTarget(config, state, func(target string) bool {
+			select {
+			case targets <- target:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	return targets, errc
+}
 
-	targetChan := make(chan string, len(targets))
-	for _, target := range targets {
-		targetChan <- target
+// readListFile calls fn for every non-empty line of a target list until fn
+// returns false
+func readListFile(path string, fn func(target string) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
 	}
-	close(targetChan)
+	defer file.Close()
 
-	s := scanner.NewScanner(config)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !fn(line) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
 
-	// Load signatures (YAML or defaults)
-	var d *detector.Detector
-	if config.SignaturesFile != "" {
-		sigs := signatures.GetSignatures(config.SignaturesFile)
-		d = detector.NewDetectorWithSignatures(sigs)
-		if !config.Silent {
-			logger.Infof("Loaded %d signatures from %s", len(sigs), config.SignaturesFile)
+// processTargets scans targets as they are read and writes every result as
+// soon as it arrives. Only summary counts are kept, so memory stays flat
+// regardless of the number of targets. When resuming, results recorded in
+// state are written first and new ones are recorded as they complete.
+func processTargets(ctx context.Context, targets <-chan string, total int, config *cli.Config, w output.ResultWriter, state *checkpoint.State) error {
+	var summary output.Summary
+
+	if state != nil {
+		err := state.Replay(func(result output.Result) error {
+			summary.Add(result)
+			return w.Write(result)
+		})
+		if err != nil {
+			return err
 		}
-	} else {
-		d = detector.NewDetector()
 	}
 
+	var writeErr error
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	client := newClient(config)
+
 	// Create progress bar for multiple targets
 	var bar *progressbar.ProgressBar
-	if len(targets) > 1 && !config.Silent {
-		bar = progressbar.NewOptions(len(targets),
+	if total > 1 && !config.Silent {
+		bar = progressbar.NewOptions(total,
 			progressbar.OptionSetDescription("Scanning"),
 			progressbar.OptionSetWidth(40),
 			progressbar.OptionShowCount(),
@@ -135,71 +276,96 @@ func processTargets(ctx context.Context, targets []string, config *cli.Config) [
 		)
 	}
 
-	for i := 0; i < config.Threads; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for target := range targetChan {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					if config.Debug {
-						logger.Debugf("Worker %d processing: %s", workerID, target)
-					}
-					result := processTarget(ctx, target, s, d, config)
-					mu.Lock()
-					results = append(results, result)
-					mu.Unlock()
-
-					if !config.Silent {
-						if bar != nil {
-							bar.Add(1)
-						} else {
-							output.PrintResult(result, config)
-						}
-					}
-				}
+	for result := range client.DetectMany(ctx, targets) {
+		summary.Add(result)
+
+		// Scans cut short by an interrupt or a transient failure are retried
+		// on resume
+		if state != nil && writeErr == nil && !result.Transient && !(result.Error != "" && ctx.Err() != nil) {
+			if err := state.Record(result); err != nil {
+				writeErr = err
+				cancel()
 			}
-		}(i)
-	}
+		}
 
-	wg.Wait()
+		if writeErr == nil {
+			if err := w.Write(result); err != nil {
+				// Stop scanning; results could no longer be saved
+				writeErr = err
+				cancel()
+			}
+		}
 
-	// Print results after progress bar completes
-	if bar != nil && !config.Silent {
-		for _, result := range results {
+		if bar != nil {
+			// Print above the bar; the next Add redraws it
+			bar.Clear()
+			output.PrintResult(result, config)
+			bar.Add(1)
+		} else {
 			output.PrintResult(result, config)
 		}
-		output.PrintSummary(results, config)
 	}
 
-	return results
+	if bar != nil {
+		bar.Finish()
+		output.PrintSummaryCounts(summary, config)
+	}
+
+	return writeErr
 }
 
-func processTarget(ctx context.Context, target string, s *scanner.Scanner, d *detector.Detector, config *cli.Config) output.Result {
-	start := time.Now()
+// newClient builds the detection client for a run, loading custom
+// signatures and probes when configured, and recording or replaying probes
+func newClient(config *cli.Config) *wafdetector.Client {
+	opts := []wafdetector.Option{
+		wafdetector.WithTimeout(config.Timeout),
+		wafdetector.WithUserAgent(config.UserAgent),
+		wafdetector.WithProxy(config.Proxy),
+		wafdetector.WithConcurrency(config.Threads),
+		wafdetector.WithMinConfidence(config.MinConfidence),
+		wafdetector.WithRateLimit(config.RateLimits()),
+		wafdetector.WithRetry(scanner.RetryPolicy{
+			MaxRetries: config.Retries,
+			Backoff:    config.RetryBackoff,
+			MaxBackoff: config.RetryMaxBackoff,
+		}),
+		wafdetector.WithHTTP2(config.HTTP2),
+	}
+	if config.Debug {
+		opts = append(opts, wafdetector.WithLogger(logger.Log))
+	}
 
-	probes, err := s.Scan(ctx, target)
-	if err != nil {
-		return output.Result{
-			URL:       target,
-			WAFFound:  false,
-			Error:     err.Error(),
-			ScanTime:  time.Since(start),
-			Timestamp: time.Now(),
+	// Merge custom signatures and probes over the embedded ones
+	if len(config.SignaturesFiles) > 0 {
+		set, err := signatures.GetMergedSignatureSet(config.SignaturesFiles)
+		if err != nil {
+			logger.Fatalf("Error loading signatures: %v", err)
+		}
+		opts = append(opts, wafdetector.WithSignatureSet(set))
+		if !config.Silent {
+			logger.Infof("Loaded %d signatures and %d custom probes from %s",
+				len(set.Signatures), len(set.Probes), strings.Join(config.SignaturesFiles, ", "))
 		}
 	}
 
-	detection := d.Detect(probes)
+	if config.RecordDir != "" {
+		recorder, err := cassette.NewRecorder(config.RecordDir, cassette.DefaultMaxBody)
+		if err != nil {
+			logger.Fatalf("Error creating detector: %v", err)
+		}
+		opts = append(opts, wafdetector.WithRecorder(recorder))
+	}
+	if config.ReplayDir != "" {
+		player, err := cassette.NewPlayer(config.ReplayDir)
+		if err != nil {
+			logger.Fatalf("Error creating detector: %v", err)
+		}
+		opts = append(opts, wafdetector.WithProber(player))
+	}
 
-	return output.Result{
-		URL:        target,
-		WAFFound:   detection.WAFDetected,
-		WAFName:    detection.WAFName,
-		Confidence: detection.Confidence,
-		Details:    detection.Details,
-		ScanTime:   time.Since(start),
-		Timestamp:  time.Now(),
+	client, err := wafdetector.New(opts...)
+	if err != nil {
+		logger.Fatalf("Error creating detector: %v", err)
 	}
+	return client
 }
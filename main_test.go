@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ahmedtouahria/waf-detector/checkpoint"
+	"github.com/ahmedtouahria/waf-detector/cli"
+	"github.com/ahmedtouahria/waf-detector/output"
+	"github.com/ahmedtouahria/waf-detector/scanner"
+)
+
+func TestNewClientRetries(t *testing.T) {
+	// Every connection is reset, a transient error the scanner retries
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+
+	probes := len(scanner.BuiltinProbeTypes())
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"retries disabled", []string{"--retries", "0"}, probes},
+		{"one retry", []string{"--retries", "1", "--retry-backoff", "1ms"}, 2 * probes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts.Store(0)
+			config := cli.ParseArgs("waf-detector", append([]string{"-u", srv.URL, "-silent"}, tt.args...))
+			result, err := newClient(config).Detect(context.Background(), srv.URL)
+			if err != nil {
+				t.Fatalf("Detect() error = %v", err)
+			}
+			if result.Error == "" {
+				t.Errorf("Detect() = %+v, want the reset reported", result)
+			}
+			if got := int(attempts.Load()); got != tt.want {
+				t.Errorf("server saw %d attempts, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessTargetsSkipsTransientFailures(t *testing.T) {
+	reset := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer reset.Close()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><h1>Welcome</h1></html>"))
+	}))
+	defer site.Close()
+
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	config := cli.ParseArgs("waf-detector", []string{"-silent", "--retries", "0", "--resume", path})
+	state := openState(config)
+
+	targets := make(chan string, 2)
+	targets <- reset.URL
+	targets <- site.URL
+	close(targets)
+
+	w, err := output.NewResultWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := processTargets(context.Background(), targets, 2, config, w, state); err != nil {
+		t.Fatalf("processTargets() error = %v", err)
+	}
+	state.Close()
+
+	opts, err := checkpoint.OptionsFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err = checkpoint.Open(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if state.Done(reset.URL) {
+		t.Error("target with a transient failure was recorded as done")
+	}
+	if !state.Done(site.URL) {
+		t.Error("scanned target was not recorded as done")
+	}
+}
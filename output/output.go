@@ -1,25 +1,51 @@
 package output
 
 import (
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ahmedtouahria/waf-detector/cli"
+	"github.com/ahmedtouahria/waf-detector/signatures"
 )
 
 type Result struct {
-	URL        string        `json:"url"`
-	WAFFound   bool          `json:"waf_found"`
-	WAFName    string        `json:"waf_name,omitempty"`
-	Confidence float64       `json:"confidence,omitempty"`
-	Details    string        `json:"details,omitempty"`
-	Error      string        `json:"error,omitempty"`
-	ScanTime   time.Duration `json:"scan_time"`
-	Timestamp  time.Time     `json:"timestamp"`
+	URL        string                `json:"url"`
+	WAFFound   bool                  `json:"waf_found"`
+	WAFName    string                `json:"waf_name,omitempty"`
+	Confidence float64               `json:"confidence,omitempty"`
+	Details    string                `json:"details,omitempty"`
+	Evidence   []signatures.Evidence `json:"evidence,omitempty"`
+	Layers     []Layer               `json:"layers,omitempty"`
+	Similarity map[string]float64    `json:"similarity,omitempty"`
+	Error      string                `json:"error,omitempty"`
+	ErrorType  string                `json:"error_type,omitempty"`
+	ScanTime   time.Duration         `json:"scan_time"`
+	Timestamp  time.Time             `json:"timestamp"`
+
+	// Challenged is set when the target answered with a challenge page
+	// instead of its content; ChallengeType is javascript, captcha or
+	// meta_refresh and Challenge the signature that recognised it
+	Challenged    bool   `json:"challenged,omitempty"`
+	ChallengeType string `json:"challenge_type,omitempty"`
+	Challenge     string `json:"challenge,omitempty"`
+
+	// Transient is set when Error is a failure that may succeed when
+	// retried, so a resumed scan tries the target again
+	Transient bool `json:"-"`
+}
+
+// Layer is one WAF or CDN product identified in front of a target
+type Layer struct {
+	Name        string                `json:"name"`
+	Vendor      string                `json:"vendor,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Role        string                `json:"role,omitempty"`
+	Confidence  float64               `json:"confidence"`
+	Evidence    []signatures.Evidence `json:"evidence,omitempty"`
 }
 
 type JSONOutput struct {
@@ -45,36 +71,36 @@ const (
 	ColorWhite  = "\033[37m"
 )
 
+// WriteResults writes all results to the configured output file
 func WriteResults(results []Result, config *cli.Config) error {
-	if config.OutputFile == "" {
-		return nil
-	}
-
-	file, err := os.Create(config.OutputFile)
+	w, err := NewResultWriter(config)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return err
 	}
-	defer file.Close()
 
-	switch config.Format {
-	case "json":
-		return writeJSON(file, results)
-	case "csv":
-		return writeCSV(file, results)
-	case "html":
-		return writeHTML(file, results)
-	default: // txt
-		return writeText(file, results, config)
+	for _, result := range results {
+		if err := w.Write(result); err != nil {
+			w.Close()
+			return err
+		}
 	}
+	return w.Close()
 }
 
-func writeJSON(file *os.File, results []Result) error {
-	summary := calculateSummary(results)
-	output := JSONOutput{
+// NewJSONOutput wraps results in the document written by the json format
+func NewJSONOutput(results []Result) JSONOutput {
+	if results == nil {
+		results = []Result{}
+	}
+	return JSONOutput{
 		Results: results,
-		Summary: summary,
+		Summary: calculateSummary(results),
 		Time:    time.Now(),
 	}
+}
+
+func writeJSON(file *os.File, results []Result) error {
+	output := NewJSONOutput(results)
 
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
@@ -84,34 +110,23 @@ func writeJSON(file *os.File, results []Result) error {
 	return nil
 }
 
-func writeCSV(file *os.File, results []Result) error {
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// Write header
-	header := []string{"URL", "WAF Detected", "WAF Name", "Confidence", "Details", "Error", "Scan Time", "Timestamp"}
-	if err := writer.Write(header); err != nil {
-		return fmt.Errorf("failed to write CSV header: %w", err)
-	}
-
-	// Write rows
-	for _, result := range results {
-		row := []string{
-			result.URL,
-			fmt.Sprintf("%t", result.WAFFound),
-			result.WAFName,
-			fmt.Sprintf("%.2f", result.Confidence),
-			result.Details,
-			result.Error,
-			result.ScanTime.String(),
-			result.Timestamp.Format(time.RFC3339),
-		}
-		if err := writer.Write(row); err != nil {
-			return fmt.Errorf("failed to write CSV row: %w", err)
-		}
+var csvHeader = []string{"URL", "WAF Detected", "WAF Name", "Confidence", "Layers", "Challenge", "Details", "Evidence", "Error", "Error Type", "Scan Time", "Timestamp"}
+
+func csvRow(result Result) []string {
+	return []string{
+		result.URL,
+		fmt.Sprintf("%t", result.WAFFound),
+		result.WAFName,
+		fmt.Sprintf("%.2f", result.Confidence),
+		formatLayerList(result.Layers),
+		formatChallenge(result),
+		result.Details,
+		formatEvidenceList(result.Evidence),
+		result.Error,
+		result.ErrorType,
+		result.ScanTime.String(),
+		result.Timestamp.Format(time.RFC3339),
 	}
-
-	return nil
 }
 
 func writeHTML(file *os.File, results []Result) error {
@@ -139,22 +154,12 @@ func writeHTML(file *os.File, results []Result) error {
 	return nil
 }
 
-func writeText(file *os.File, results []Result, config *cli.Config) error {
-	for _, result := range results {
-		line := formatTextResult(result, config)
-		if _, err := file.WriteString(line + "\n"); err != nil {
-			return fmt.Errorf("failed to write to file: %w", err)
-		}
-	}
-	return nil
-}
-
 func PrintResult(result Result, config *cli.Config) {
 	if config.Silent {
 		return
 	}
 
-	if config.Format == "json" {
+	if config.Format == "json" || config.Format == "jsonl" {
 		data, _ := json.Marshal(result)
 		fmt.Println(string(data))
 	} else {
@@ -174,15 +179,25 @@ func formatTextResult(result Result, config *cli.Config) string {
 	}
 
 	if !result.WAFFound {
+		info := "No WAF detected"
+		if result.Challenged {
+			info += " [" + formatChallenge(result) + "]"
+		}
 		if useColor {
-			return fmt.Sprintf("[%s--%s] %s - %sNo WAF detected%s",
-				ColorYellow, ColorReset, result.URL, ColorYellow, ColorReset)
+			return fmt.Sprintf("[%s--%s] %s - %s%s%s",
+				ColorYellow, ColorReset, result.URL, ColorYellow, info, ColorReset)
 		}
-		return fmt.Sprintf("[--] %s - No WAF detected", result.URL)
+		return fmt.Sprintf("[--] %s - %s", result.URL, info)
 	}
 
 	wafInfo := "WAF detected"
-	if result.WAFName != "" {
+	if len(result.Layers) > 1 {
+		names := make([]string, 0, len(result.Layers))
+		for _, layer := range result.Layers {
+			names = append(names, formatLayer(layer))
+		}
+		wafInfo = strings.Join(names, " + ")
+	} else if result.WAFName != "" {
 		if result.Confidence > 0 {
 			wafInfo = fmt.Sprintf("%s (%.0f%% confidence)", result.WAFName, result.Confidence*100)
 		} else {
@@ -190,38 +205,99 @@ func formatTextResult(result Result, config *cli.Config) string {
 		}
 	}
 
+	if result.Challenged {
+		wafInfo += " [" + formatChallenge(result) + "]"
+	}
+
+	var line string
 	if useColor {
-		return fmt.Sprintf("[%s++%s] %s - %s%s%s [%s%.2fs%s]",
+		line = fmt.Sprintf("[%s++%s] %s - %s%s%s [%s%.2fs%s]",
 			ColorGreen, ColorReset, result.URL, ColorCyan, wafInfo, ColorReset,
 			ColorBlue, result.ScanTime.Seconds(), ColorReset)
+	} else {
+		line = fmt.Sprintf("[++] %s - %s [%.2fs]", result.URL, wafInfo, result.ScanTime.Seconds())
+	}
+
+	if len(result.Layers) > 1 {
+		for _, layer := range result.Layers {
+			line += "\n    " + formatLayer(layer)
+			for _, evidence := range layer.Evidence {
+				line += "\n      - " + evidence.String()
+			}
+		}
+		return line
+	}
+
+	for _, evidence := range result.Evidence {
+		line += "\n    - " + evidence.String()
 	}
 
-	return fmt.Sprintf("[++] %s - %s [%.2fs]", result.URL, wafInfo, result.ScanTime.Seconds())
+	return line
 }
 
-func calculateSummary(results []Result) Summary {
-	summary := Summary{
-		TotalScanned: len(results),
+// formatLayer renders a layer as "Name [role] (NN% confidence)"
+func formatLayer(layer Layer) string {
+	if layer.Role == "" {
+		return fmt.Sprintf("%s (%.0f%% confidence)", layer.Name, layer.Confidence*100)
 	}
+	return fmt.Sprintf("%s [%s] (%.0f%% confidence)", layer.Name, layer.Role, layer.Confidence*100)
+}
 
-	for _, result := range results {
-		if result.Error != "" {
-			summary.Errors++
-		} else if result.WAFFound {
-			summary.WAFsDetected++
-		}
+// formatChallenge renders the challenge as "type challenge (Name)", or an
+// empty string when the target was not challenged
+func formatChallenge(result Result) string {
+	if !result.Challenged {
+		return ""
 	}
+	return fmt.Sprintf("%s challenge (%s)", result.ChallengeType, result.Challenge)
+}
+
+// formatLayerList joins layers into a single field for tabular output
+func formatLayerList(layers []Layer) string {
+	parts := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		parts = append(parts, formatLayer(layer))
+	}
+	return strings.Join(parts, "; ")
+}
 
+// formatEvidenceList joins evidence into a single field for tabular output
+func formatEvidenceList(evidence []signatures.Evidence) string {
+	parts := make([]string, 0, len(evidence))
+	for _, e := range evidence {
+		parts = append(parts, e.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Add counts a result in the summary
+func (s *Summary) Add(result Result) {
+	s.TotalScanned++
+	if result.Error != "" {
+		s.Errors++
+	} else if result.WAFFound {
+		s.WAFsDetected++
+	}
+}
+
+func calculateSummary(results []Result) Summary {
+	var summary Summary
+	for _, result := range results {
+		summary.Add(result)
+	}
 	return summary
 }
 
 func PrintSummary(results []Result, config *cli.Config) {
+	PrintSummaryCounts(calculateSummary(results), config)
+}
+
+// PrintSummaryCounts prints summary statistics counted while streaming
+func PrintSummaryCounts(summary Summary, config *cli.Config) {
 	if config.Silent {
 		return
 	}
 
-	summary := calculateSummary(results)
-
 	fmt.Println()
 	fmt.Println("=== Scan Summary ===")
 	fmt.Printf("Total scanned:  %d\n", summary.TotalScanned)
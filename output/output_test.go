@@ -1,11 +1,15 @@
 package output
 
 import (
+	"encoding/json"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ahmedtouahria/waf-detector/cli"
+	"github.com/ahmedtouahria/waf-detector/signatures"
 )
 
 func TestResult(t *testing.T) {
@@ -93,3 +97,147 @@ func TestWriteResultsText(t *testing.T) {
 		t.Errorf("WriteResults failed: %v", err)
 	}
 }
+
+func TestFormatTextResultEvidence(t *testing.T) {
+	config := &cli.Config{NoColor: true}
+	result := Result{
+		URL:        "https://example.com",
+		WAFFound:   true,
+		WAFName:    "Cloudflare",
+		Confidence: 0.65,
+		Evidence: []signatures.Evidence{
+			{Type: "header", Key: "CF-Ray", Condition: "exists", Value: "7d1f-CDG", Probe: "normal", Confidence: 0.35},
+			{Type: "body", Condition: "regex", Value: "Ray ID: 7d1f", Probe: "sqli", Confidence: 0.3,
+				Captures: map[string]string{"ray_id": "7d1f"}},
+		},
+	}
+
+	text := formatTextResult(result, config)
+	for _, want := range []string{
+		`header CF-Ray exists "7d1f-CDG" on normal probe (+0.35)`,
+		`on sqli probe (+0.30) ray_id=7d1f`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text output missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestFormatChallenge(t *testing.T) {
+	result := Result{
+		URL:           "https://example.com",
+		WAFFound:      true,
+		WAFName:       "DataDome",
+		Confidence:    0.9,
+		Challenged:    true,
+		ChallengeType: "captcha",
+		Challenge:     "DataDome CAPTCHA",
+	}
+
+	want := "[++] https://example.com - DataDome (90% confidence) [captcha challenge (DataDome CAPTCHA)]"
+	if text := formatTextResult(result, &cli.Config{NoColor: true}); !strings.HasPrefix(text, want) {
+		t.Errorf("formatTextResult() = %q, want prefix %q", text, want)
+	}
+	unprotected := Result{URL: "https://example.com", Challenged: true, ChallengeType: "captcha", Challenge: "CAPTCHA Widget"}
+	want = "[--] https://example.com - No WAF detected [captcha challenge (CAPTCHA Widget)]"
+	if text := formatTextResult(unprotected, &cli.Config{NoColor: true}); text != want {
+		t.Errorf("formatTextResult() = %q, want %q", text, want)
+	}
+	if row := csvRow(result); row[5] != "captcha challenge (DataDome CAPTCHA)" || csvHeader[5] != "Challenge" {
+		t.Errorf("CSV challenge column = %q (%s)", row[5], csvHeader[5])
+	}
+	if row := csvRow(Result{URL: "https://example.com"}); row[5] != "" {
+		t.Errorf("CSV challenge column = %q, want empty", row[5])
+	}
+}
+
+func TestResultWriterJSONLStreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	config := &cli.Config{OutputFile: path, Format: "jsonl"}
+
+	w, err := NewResultWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	var summary Summary
+	for _, result := range []Result{
+		{URL: "https://a.example", WAFFound: true, WAFName: "Cloudflare"},
+		{URL: "https://b.example", Error: "timeout"},
+	} {
+		if err := w.Write(result); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		summary.Add(result)
+	}
+
+	// Results must be on disk before Close so an interrupted run keeps them
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines before Close, want 2:\n%s", len(lines), data)
+	}
+	var first Result
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.WAFName != "Cloudflare" {
+		t.Errorf("first line = %s (%v)", lines[0], err)
+	}
+
+	if summary != (Summary{TotalScanned: 2, WAFsDetected: 1, Errors: 1}) {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestSARIFLog(t *testing.T) {
+	results := []Result{
+		{
+			URL:        "https://a.example",
+			WAFFound:   true,
+			WAFName:    "Cloudflare",
+			Confidence: 0.95,
+			Layers: []Layer{
+				{Name: "Cloudflare", Vendor: "Cloudflare", Description: "Cloudflare Web Application Firewall", Role: "cloud-waf", Confidence: 0.95,
+					Evidence: []signatures.Evidence{{Type: "header", Key: "CF-Ray", Condition: "exists", Probe: "normal", Confidence: 0.35}}},
+				{Name: "AWS WAF", Vendor: "Amazon", Role: "cloud-waf", Confidence: 0.4},
+			},
+		},
+		{URL: "https://b.example", WAFFound: true, WAFName: "Cloudflare", Confidence: 0.8,
+			Layers: []Layer{{Name: "Cloudflare", Confidence: 0.8}}},
+		{URL: "https://c.example", WAFFound: true, WAFName: "Unknown WAF", Confidence: 0.5},
+		{URL: "https://d.example"},
+		{URL: "https://e.example", Error: "timeout", ErrorType: "TIMEOUT"},
+	}
+
+	log := newSARIFLog(results)
+	run := log.Runs[0]
+
+	var ids []string
+	for _, rule := range run.Tool.Driver.Rules {
+		ids = append(ids, rule.ID)
+	}
+	if strings.Join(ids, ",") != "cloudflare,aws-waf,unknown-waf" {
+		t.Errorf("rules = %v", ids)
+	}
+	if rule := run.Tool.Driver.Rules[0]; rule.ShortDescription.Text != "Cloudflare Web Application Firewall" || rule.Properties["vendor"] != "Cloudflare" {
+		t.Errorf("cloudflare rule = %+v", rule)
+	}
+
+	if len(run.Results) != 4 {
+		t.Fatalf("got %d results, want 4", len(run.Results))
+	}
+	second := run.Results[2]
+	if second.RuleID != "cloudflare" || second.RuleIndex != 0 || second.Locations[0].PhysicalLocation.ArtifactLocation.URI != "https://b.example" {
+		t.Errorf("second cloudflare result = %+v", second)
+	}
+	if _, ok := run.Results[0].Properties["evidence"]; !ok {
+		t.Error("evidence missing from result properties")
+	}
+
+	notifications := run.Invocations[0].ToolExecutionNotifications
+	if len(notifications) != 1 || notifications[0].Message.Text != "timeout" || notifications[0].Properties["errorType"] != "TIMEOUT" {
+		t.Errorf("notifications = %+v", notifications)
+	}
+}
@@ -0,0 +1,239 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolName     = "waf-detector"
+	toolURI      = "https://github.com/ahmedtouahria/waf-detector"
+
+	// unknownRuleID is reported for WAF-like blocking that no signature matched
+	unknownRuleID = "unknown-waf"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	ShortDescription sarifMessage      `json:"shortDescription"`
+	Properties       map[string]string `json:"properties,omitempty"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID     string                 `json:"ruleId"`
+	RuleIndex  int                    `json:"ruleIndex"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifRules assigns every detected signature a rule, in order of first use
+type sarifRules struct {
+	rules []sarifRule
+	index map[string]int
+}
+
+func (r *sarifRules) add(layer Layer) int {
+	id := ruleID(layer.Name)
+	if i, ok := r.index[id]; ok {
+		return i
+	}
+
+	description := layer.Description
+	if description == "" {
+		description = layer.Name
+	}
+	rule := sarifRule{
+		ID:               id,
+		Name:             layer.Name,
+		ShortDescription: sarifMessage{Text: description},
+	}
+	if layer.Vendor != "" || layer.Role != "" {
+		rule.Properties = map[string]string{}
+		if layer.Vendor != "" {
+			rule.Properties["vendor"] = layer.Vendor
+		}
+		if layer.Role != "" {
+			rule.Properties["role"] = layer.Role
+		}
+	}
+
+	r.index[id] = len(r.rules)
+	r.rules = append(r.rules, rule)
+	return len(r.rules) - 1
+}
+
+// ruleID turns a signature name into a stable rule identifier such as
+// "aws-waf"
+func ruleID(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// newSARIFLog converts results to a SARIF log. Every detected layer becomes
+// a result of the rule for its signature, located at the target URL.
+// Detections without a matching signature use the unknown-waf rule and scan
+// errors are reported as tool notifications.
+func newSARIFLog(results []Result) sarifLog {
+	rules := &sarifRules{index: make(map[string]int)}
+	run := sarifRun{
+		Invocations: []sarifInvocation{{ExecutionSuccessful: true}},
+		Results:     []sarifResult{},
+	}
+
+	for _, result := range results {
+		location := []sarifLocation{{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: result.URL},
+			},
+		}}
+
+		if result.Error != "" {
+			notification := sarifNotification{
+				Level:     "error",
+				Message:   sarifMessage{Text: result.Error},
+				Locations: location,
+			}
+			if result.ErrorType != "" {
+				notification.Properties = map[string]string{"errorType": result.ErrorType}
+			}
+			run.Invocations[0].ToolExecutionNotifications = append(run.Invocations[0].ToolExecutionNotifications, notification)
+			continue
+		}
+		if !result.WAFFound {
+			continue
+		}
+
+		layers := result.Layers
+		if len(layers) == 0 {
+			layers = []Layer{{
+				Name:        unknownRuleID,
+				Description: "WAF-like blocking behavior without a matching signature",
+				Confidence:  result.Confidence,
+				Evidence:    result.Evidence,
+			}}
+		}
+
+		for _, layer := range layers {
+			index := rules.add(layer)
+			run.Results = append(run.Results, sarifResult{
+				RuleID:     rules.rules[index].ID,
+				RuleIndex:  index,
+				Level:      "note",
+				Message:    sarifMessage{Text: sarifMessageText(result.URL, layer)},
+				Locations:  location,
+				Properties: sarifProperties(layer),
+			})
+		}
+	}
+
+	run.Tool = sarifTool{Driver: sarifDriver{
+		Name:           toolName,
+		InformationURI: toolURI,
+		Rules:          rules.rules,
+	}}
+	if run.Tool.Driver.Rules == nil {
+		run.Tool.Driver.Rules = []sarifRule{}
+	}
+
+	return sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	}
+}
+
+func sarifMessageText(url string, layer Layer) string {
+	if layer.Name == unknownRuleID {
+		return fmt.Sprintf("Unidentified WAF detected in front of %s", url)
+	}
+	return fmt.Sprintf("%s detected in front of %s (%.0f%% confidence)", layer.Name, url, layer.Confidence*100)
+}
+
+func sarifProperties(layer Layer) map[string]interface{} {
+	props := map[string]interface{}{
+		"confidence": layer.Confidence,
+	}
+	if layer.Role != "" {
+		props["role"] = layer.Role
+	}
+	if len(layer.Evidence) > 0 {
+		props["evidence"] = layer.Evidence
+	}
+	return props
+}
+
+func writeSARIF(file *os.File, results []Result) error {
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(newSARIFLog(results)); err != nil {
+		return fmt.Errorf("failed to encode SARIF: %w", err)
+	}
+	return nil
+}
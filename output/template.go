@@ -113,6 +113,25 @@ const htmlTemplate = `<!DOCTYPE html>
             font-weight: 600;
             color: #667eea;
         }
+        .badge-role {
+            background: #e7e9fd;
+            color: #3b4cca;
+            padding: 2px 8px;
+        }
+        .layer + .layer {
+            margin-top: 6px;
+        }
+        .evidence {
+            margin-top: 8px;
+            padding-left: 18px;
+            font-size: 0.85em;
+            color: #495057;
+        }
+        .evidence code {
+            background: #f1f3f5;
+            padding: 1px 4px;
+            border-radius: 3px;
+        }
         footer {
             text-align: center;
             padding: 20px;
@@ -168,14 +187,20 @@ const htmlTemplate = `<!DOCTYPE html>
                     <td><strong>{{ .URL }}</strong></td>
                     <td>
                         {{ if .Error }}
-                            <span class="badge badge-danger">Error</span>
+                            <span class="badge badge-danger">Error{{ if .ErrorType }}: {{ .ErrorType }}{{ end }}</span>
                         {{ else if .WAFFound }}
                             <span class="badge badge-success">WAF Detected</span>
                         {{ else }}
                             <span class="badge badge-warning">No WAF</span>
                         {{ end }}
                     </td>
-                    <td>{{ if .WAFName }}{{ .WAFName }}{{ else }}-{{ end }}</td>
+                    <td>
+                        {{ if gt (len .Layers) 1 }}
+                            {{ range .Layers }}
+                            <div class="layer">{{ .Name }}{{ if .Role }} <span class="badge badge-role">{{ .Role }}</span>{{ end }}</div>
+                            {{ end }}
+                        {{ else if .WAFName }}{{ .WAFName }}{{ else }}-{{ end }}
+                    </td>
                     <td>
                         {{ if gt .Confidence 0.0 }}
                             <span class="confidence">{{ printf "%.0f" .Confidence }}%</span>
@@ -187,6 +212,13 @@ const htmlTemplate = `<!DOCTYPE html>
                         {{ else if .Details }}
                             {{ .Details }}
                         {{ else }}-{{ end }}
+                        {{ if .Evidence }}
+                        <ul class="evidence">
+                            {{ range .Evidence }}
+                            <li><code>{{ .Type }}{{ if .Key }} {{ .Key }}{{ end }}</code>{{ if .Value }} &ldquo;{{ .Value }}&rdquo;{{ end }} on <em>{{ .Probe }}</em> (+{{ printf "%.2f" .Confidence }}){{ range $name, $value := .Captures }} <code>{{ $name }}={{ $value }}</code>{{ end }}</li>
+                            {{ end }}
+                        </ul>
+                        {{ end }}
                     </td>
                 </tr>
                 {{ end }}
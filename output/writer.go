@@ -0,0 +1,135 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ahmedtouahria/waf-detector/cli"
+)
+
+// ResultWriter writes results to the output file as they are produced
+type ResultWriter interface {
+	Write(result Result) error
+	Close() error
+}
+
+// NewResultWriter creates the writer for the configured output file and
+// format. The txt, jsonl and csv formats flush every result to the file as it
+// is written, so an interrupted run keeps everything scanned so far. The
+// json, html and sarif formats are single documents rendered on Close.
+func NewResultWriter(config *cli.Config) (ResultWriter, error) {
+	if config.OutputFile == "" {
+		return discardWriter{}, nil
+	}
+
+	file, err := os.Create(config.OutputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	switch config.Format {
+	case "jsonl":
+		return &jsonlWriter{file: file, encoder: json.NewEncoder(file)}, nil
+	case "csv":
+		w := &csvWriter{file: file, writer: csv.NewWriter(file)}
+		if err := w.writeRow(csvHeader); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write CSV header: %w", err)
+		}
+		return w, nil
+	case "json":
+		return &documentWriter{file: file, write: writeJSON}, nil
+	case "html":
+		return &documentWriter{file: file, write: writeHTML}, nil
+	case "sarif":
+		return &documentWriter{file: file, write: writeSARIF}, nil
+	default: // txt
+		return &textWriter{file: file, config: config}, nil
+	}
+}
+
+// discardWriter is used when no output file is configured
+type discardWriter struct{}
+
+func (discardWriter) Write(Result) error { return nil }
+func (discardWriter) Close() error       { return nil }
+
+// jsonlWriter writes one JSON object per line
+type jsonlWriter struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func (w *jsonlWriter) Write(result Result) error {
+	if err := w.encoder.Encode(result); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return nil
+}
+
+func (w *jsonlWriter) Close() error {
+	return w.file.Close()
+}
+
+type csvWriter struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func (w *csvWriter) Write(result Result) error {
+	if err := w.writeRow(csvRow(result)); err != nil {
+		return fmt.Errorf("failed to write CSV row: %w", err)
+	}
+	return nil
+}
+
+// writeRow writes and flushes a single row
+func (w *csvWriter) writeRow(row []string) error {
+	if err := w.writer.Write(row); err != nil {
+		return err
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvWriter) Close() error {
+	return w.file.Close()
+}
+
+type textWriter struct {
+	file   *os.File
+	config *cli.Config
+}
+
+func (w *textWriter) Write(result Result) error {
+	if _, err := w.file.WriteString(formatTextResult(result, w.config) + "\n"); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return nil
+}
+
+func (w *textWriter) Close() error {
+	return w.file.Close()
+}
+
+// documentWriter collects results and renders them as one document on Close
+type documentWriter struct {
+	file    *os.File
+	results []Result
+	write   func(file *os.File, results []Result) error
+}
+
+func (w *documentWriter) Write(result Result) error {
+	w.results = append(w.results, result)
+	return nil
+}
+
+func (w *documentWriter) Close() error {
+	err := w.write(w.file, w.results)
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,232 @@
+// Package ratelimit throttles probe requests globally and per host, so scans
+// stay within agreed request rates and do not trip the rate limits that
+// would skew detection towards 429 responses.
+//
+// Rates are enforced as token buckets holding a single token: requests are
+// spaced evenly rather than sent in bursts. Hosts are forgotten once they
+// are idle, so memory stays flat while streaming large target lists.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits configures a Limiter. Zero values leave that limit off.
+type Limits struct {
+	// Rate is the number of requests per second across all hosts
+	Rate float64
+	// PerHostRate is the number of requests per second to each host
+	PerHostRate float64
+	// Delay is the pause between consecutive requests to the same host
+	Delay time.Duration
+	// Jitter is the upper bound of a random pause added to Delay
+	Jitter time.Duration
+	// MaxPerHost is the number of requests in flight to each host
+	MaxPerHost int
+}
+
+// Validate checks that no limit is negative
+func (l Limits) Validate() error {
+	switch {
+	case l.Rate < 0:
+		return fmt.Errorf("rate must not be negative, got %v", l.Rate)
+	case l.PerHostRate < 0:
+		return fmt.Errorf("per-host rate must not be negative, got %v", l.PerHostRate)
+	case l.Delay < 0:
+		return fmt.Errorf("delay must not be negative, got %v", l.Delay)
+	case l.Jitter < 0:
+		return fmt.Errorf("jitter must not be negative, got %v", l.Jitter)
+	case l.MaxPerHost < 0:
+		return fmt.Errorf("max per host must not be negative, got %d", l.MaxPerHost)
+	}
+	return nil
+}
+
+// Enabled reports whether any limit is set
+func (l Limits) Enabled() bool {
+	return l != Limits{}
+}
+
+// Limiter schedules requests within its limits. It is safe for concurrent
+// use.
+type Limiter struct {
+	limits Limits
+	now    func() time.Time
+
+	mu     sync.Mutex
+	rand   *rand.Rand
+	global bucket
+	hosts  map[string]*host
+	// sweepAt is the number of hosts at which idle ones are evicted next
+	sweepAt int
+}
+
+// minSweep is the smallest number of hosts that triggers an eviction sweep
+const minSweep = 64
+
+// host is the scheduling state of one host
+type host struct {
+	// slots holds a token for every request in flight, when MaxPerHost is set
+	slots chan struct{}
+	rate  bucket
+	// next is the earliest start allowed by Delay and Jitter
+	next time.Time
+	// users counts the Wait calls whose request is not yet released
+	users int
+}
+
+// idle reports whether forgetting h changes no future schedule
+func (h *host) idle(now time.Time) bool {
+	return h.users == 0 && !h.rate.next.After(now) && !h.next.After(now)
+}
+
+// bucket spaces requests at least interval apart
+type bucket struct {
+	interval time.Duration
+	// next is the earliest time the bucket holds a token again
+	next time.Time
+}
+
+func newBucket(rate float64) bucket {
+	if rate <= 0 {
+		return bucket{}
+	}
+	return bucket{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// take uses the token at start; a bucket without a rate has no effect
+func (b *bucket) take(start time.Time) {
+	if b.interval > 0 {
+		b.next = start.Add(b.interval)
+	}
+}
+
+// New creates a limiter
+func New(limits Limits) (*Limiter, error) {
+	if err := limits.Validate(); err != nil {
+		return nil, err
+	}
+	return &Limiter{
+		limits:  limits,
+		now:     time.Now,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		global:  newBucket(limits.Rate),
+		hosts:   make(map[string]*host),
+		sweepAt: minSweep,
+	}, nil
+}
+
+// Wait blocks until a request to hostname may start. The returned release
+// must be called once the request, including reading its body, is done.
+func (l *Limiter) Wait(ctx context.Context, hostname string) (release func(), err error) {
+	h := l.host(hostname)
+
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			l.done(h)
+			return nil, ctx.Err()
+		}
+	}
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			if h.slots != nil {
+				<-h.slots
+			}
+			l.done(h)
+		})
+	}
+
+	if wait := l.reserve(h).Sub(l.now()); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// host returns the state of hostname, creating it on first use, and holds
+// it until done is called
+func (l *Limiter) host(hostname string) *host {
+	hostname = strings.ToLower(hostname)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h, ok := l.hosts[hostname]
+	if !ok {
+		if len(l.hosts) >= l.sweepAt {
+			l.sweepLocked()
+		}
+		h = &host{rate: newBucket(l.limits.PerHostRate)}
+		if l.limits.MaxPerHost > 0 {
+			h.slots = make(chan struct{}, l.limits.MaxPerHost)
+		}
+		l.hosts[hostname] = h
+	}
+	h.users++
+	return h
+}
+
+// done lets go of a host returned by host
+func (l *Limiter) done(h *host) {
+	l.mu.Lock()
+	h.users--
+	l.mu.Unlock()
+}
+
+// sweepLocked evicts idle hosts. The next sweep waits until the map has
+// doubled, which keeps eviction cheap per request.
+func (l *Limiter) sweepLocked() {
+	now := l.now()
+	for hostname, h := range l.hosts {
+		if h.idle(now) {
+			delete(l.hosts, hostname)
+		}
+	}
+	l.sweepAt = 2 * len(l.hosts)
+	if l.sweepAt < minSweep {
+		l.sweepAt = minSweep
+	}
+}
+
+// reserve books the earliest start allowed by every limit and returns it
+func (l *Limiter) reserve(h *host) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start := latest(l.now(), h.rate.next, h.next, l.global.next)
+
+	h.rate.take(start)
+	l.global.take(start)
+	if l.limits.Delay > 0 || l.limits.Jitter > 0 {
+		pause := l.limits.Delay
+		if l.limits.Jitter > 0 {
+			pause += time.Duration(l.rand.Int63n(int64(l.limits.Jitter) + 1))
+		}
+		h.next = start.Add(pause)
+	}
+	return start
+}
+
+func latest(times ...time.Time) time.Time {
+	var max time.Time
+	for _, t := range times {
+		if t.After(max) {
+			max = t
+		}
+	}
+	return max
+}
@@ -0,0 +1,214 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newFakeLimiter returns a limiter whose clock stands still at the returned
+// time
+func newFakeLimiter(t *testing.T, limits Limits) (*Limiter, time.Time) {
+	t.Helper()
+	l, err := New(limits)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	now := time.Date(2025, 12, 31, 10, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, now
+}
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		hosts  []string
+		want   []time.Duration
+	}{
+		{
+			name:   "unlimited",
+			limits: Limits{},
+			hosts:  []string{"a", "a", "b"},
+			want:   []time.Duration{0, 0, 0},
+		},
+		{
+			name:   "global rate spans hosts",
+			limits: Limits{Rate: 10},
+			hosts:  []string{"a", "b", "c"},
+			want:   []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond},
+		},
+		{
+			name:   "per-host rate",
+			limits: Limits{PerHostRate: 2},
+			hosts:  []string{"a", "b", "a", "A"},
+			want:   []time.Duration{0, 0, 500 * time.Millisecond, time.Second},
+		},
+		{
+			name:   "delay",
+			limits: Limits{Delay: 300 * time.Millisecond},
+			hosts:  []string{"a", "a", "b"},
+			want:   []time.Duration{0, 300 * time.Millisecond, 0},
+		},
+		{
+			name:   "slowest limit wins",
+			limits: Limits{Rate: 20, PerHostRate: 5, Delay: 100 * time.Millisecond},
+			hosts:  []string{"a", "b", "a"},
+			want:   []time.Duration{0, 50 * time.Millisecond, 200 * time.Millisecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, now := newFakeLimiter(t, tt.limits)
+			for i, hostname := range tt.hosts {
+				got := l.reserve(l.host(hostname)).Sub(now)
+				if got != tt.want[i] {
+					t.Errorf("request %d to %s starts after %v, want %v", i, hostname, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReserveJitter(t *testing.T) {
+	limits := Limits{Delay: 100 * time.Millisecond, Jitter: 50 * time.Millisecond}
+	l, now := newFakeLimiter(t, limits)
+	h := l.host("a")
+
+	prev := l.reserve(h)
+	for i := 0; i < 20; i++ {
+		start := l.reserve(h)
+		if gap := start.Sub(prev); gap < limits.Delay || gap > limits.Delay+limits.Jitter {
+			t.Fatalf("gap = %v, want between %v and %v", gap, limits.Delay, limits.Delay+limits.Jitter)
+		}
+		prev = start
+	}
+	if prev.Sub(now) == 20*limits.Delay {
+		t.Error("jitter never added a pause")
+	}
+}
+
+func TestWaitMaxPerHost(t *testing.T) {
+	l, err := New(Limits{MaxPerHost: 1})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	release, err := l.Wait(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	// Other hosts are not held up
+	other, err := l.Wait(context.Background(), "example.org")
+	if err != nil {
+		t.Fatalf("Wait() for another host error = %v", err)
+	}
+	other()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Wait(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait() with a request in flight error = %v, want deadline exceeded", err)
+	}
+
+	release()
+	release() // releasing twice frees one slot only
+	second, err := l.Wait(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Wait() after release error = %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Wait(ctx, "example.com"); err == nil {
+		t.Error("Wait() should block while the second request is in flight")
+	}
+	second()
+}
+
+func TestWaitRate(t *testing.T) {
+	l, err := New(Limits{Rate: 50})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := l.Wait(context.Background(), "example.com")
+		if err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("3 requests at 50/s took %v, want at least 40ms", elapsed)
+	}
+}
+
+func TestEvictIdleHosts(t *testing.T) {
+	l, now := newFakeLimiter(t, Limits{PerHostRate: 1, MaxPerHost: 1})
+	ctx := context.Background()
+
+	// A host with a request in flight is kept however long it takes
+	busy, err := l.Wait(ctx, "busy.example")
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	// Each host is scanned once, a second apart
+	clock := now.Add(500 * time.Millisecond)
+	l.now = func() time.Time { return clock }
+	for i := 0; i < 10*minSweep; i++ {
+		release, err := l.Wait(ctx, fmt.Sprintf("host%d.example", i))
+		if err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		release()
+		clock = clock.Add(time.Second)
+	}
+
+	if n := len(l.hosts); n > 2*minSweep {
+		t.Errorf("limiter holds %d hosts after streaming %d, want at most %d", n, 10*minSweep, 2*minSweep)
+	}
+	if _, ok := l.hosts["busy.example"]; !ok {
+		t.Error("a host with a request in flight was evicted")
+	}
+
+	// A host still rate limited is kept, so its next request keeps its
+	// spacing
+	l.hosts["limited.example"] = &host{rate: bucket{interval: time.Second, next: clock.Add(time.Second)}}
+	l.mu.Lock()
+	l.sweepLocked()
+	l.mu.Unlock()
+	if _, ok := l.hosts["limited.example"]; !ok {
+		t.Error("a host whose next request is still rate limited was evicted")
+	}
+
+	// Once released and past its schedule, every host goes
+	busy()
+	l.now = func() time.Time { return now.Add(time.Hour) }
+	l.mu.Lock()
+	l.sweepLocked()
+	l.mu.Unlock()
+	if n := len(l.hosts); n != 0 {
+		t.Errorf("limiter holds %d idle hosts after a sweep, want 0", n)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []Limits{
+		{Rate: -1},
+		{PerHostRate: -1},
+		{Delay: -time.Second},
+		{Jitter: -time.Second},
+		{MaxPerHost: -1},
+	}
+	for _, limits := range invalid {
+		if _, err := New(limits); err == nil {
+			t.Errorf("New(%+v) should fail", limits)
+		}
+	}
+}
@@ -11,6 +11,10 @@ import (
 	"time"
 
 	"github.com/ahmedtouahria/waf-detector/cli"
+	waferrors "github.com/ahmedtouahria/waf-detector/errors"
+	"github.com/ahmedtouahria/waf-detector/logger"
+	"github.com/ahmedtouahria/waf-detector/ratelimit"
+	"github.com/sirupsen/logrus"
 )
 
 type ProbeType string
@@ -22,6 +26,51 @@ const (
 	ProbeMalformed ProbeType = "malformed"
 )
 
+// BuiltinProbeTypes returns the probes every scan sends, in the order they run
+func BuiltinProbeTypes() []ProbeType {
+	return []ProbeType{ProbeNormal, ProbeSQLi, ProbeXSS, ProbeMalformed}
+}
+
+// ProbeDefinition describes a custom probe declared in a signatures file.
+// Its Name becomes the ProbeType of the results it produces.
+type ProbeDefinition struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description,omitempty"`
+	Method      string            `yaml:"method,omitempty"`
+	Path        string            `yaml:"path,omitempty"`
+	Query       map[string]string `yaml:"query,omitempty"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	Body        string            `yaml:"body,omitempty"`
+	ContentType string            `yaml:"content_type,omitempty"`
+}
+
+// Type returns the probe type results of this probe are stored under
+func (p ProbeDefinition) Type() ProbeType {
+	return ProbeType(p.Name)
+}
+
+// Validate checks that the definition can be turned into a request
+func (p ProbeDefinition) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("probe name is required")
+	}
+	for _, builtin := range BuiltinProbeTypes() {
+		if p.Type() == builtin {
+			return fmt.Errorf("probe %q conflicts with a built-in probe", p.Name)
+		}
+	}
+	switch strings.ToUpper(p.Method) {
+	case "", http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		return fmt.Errorf("probe %q has unsupported method %q", p.Name, p.Method)
+	}
+	if _, err := url.Parse(p.Path); err != nil {
+		return fmt.Errorf("probe %q has invalid path: %w", p.Name, err)
+	}
+	return nil
+}
+
 type ProbeResult struct {
 	Type       ProbeType
 	StatusCode int
@@ -30,30 +79,203 @@ type ProbeResult struct {
 	BodyLength int
 	Duration   time.Duration
 	Error      error
+
+	// URL is the address the response came from, after any redirects
+	URL string
+
+	// Request is the request the probe sent, before any redirects. It is nil
+	// when no request could be built.
+	Request *ProbeRequest
+
+	// Samples holds the bodies of repeated normal probes, which show the
+	// parts of the page that change between requests
+	Samples []string
+
+	// TLS describes the connection the response arrived on. It is nil for
+	// plain HTTP responses.
+	TLS *TLSInfo
+}
+
+// ProbeRequest describes the request a probe sent
+type ProbeRequest struct {
+	Method  string
+	URL     string
+	Headers http.Header
+	Body    string
+}
+
+// TLSInfo describes a TLS connection and the leaf certificate the server
+// presented on it. Edge WAFs often terminate TLS with certificates and
+// settings that identify them.
+type TLSInfo struct {
+	// Version is the negotiated protocol version, e.g. "TLS 1.3"
+	Version     string
+	CipherSuite string
+	// ALPN is the negotiated application protocol, e.g. "h2", or empty when
+	// the server negotiated none
+	ALPN string
+
+	// Issuer and Subject are the distinguished names of the leaf certificate
+	Issuer  string
+	Subject string
+	// SANs holds the DNS names and IP addresses the certificate is valid for
+	SANs []string
+}
+
+// newTLSInfo summarises a connection state; it returns nil for plain HTTP
+func newTLSInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+
+	info := &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+	}
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		info.Issuer = leaf.Issuer.String()
+		info.Subject = leaf.Subject.String()
+		info.SANs = append(info.SANs, leaf.DNSNames...)
+		for _, ip := range leaf.IPAddresses {
+			info.SANs = append(info.SANs, ip.String())
+		}
+	}
+	return info
 }
 
 type Scanner struct {
 	client *http.Client
-	config *cli.Config
+	opts   Options
+	custom []ProbeDefinition
 }
 
+// Options configures a Scanner independently of the command line
+type Options struct {
+	Timeout   time.Duration
+	UserAgent string
+	// Proxy is only applied to the default transport
+	Proxy string
+	// Transport replaces the default transport, e.g. to route probes through
+	// an existing client stack or serve them from fixtures
+	Transport http.RoundTripper
+	// Logger receives per-probe debug output when set
+	Logger logrus.FieldLogger
+	// BaselineSamples is how many times the normal probe is sent; below 2 it
+	// is sent once
+	BaselineSamples int
+	// Limiter throttles every probe request when set. Share one limiter
+	// between scanners to apply its limits across them.
+	Limiter *ratelimit.Limiter
+	// Retry controls how probes that fail with transient errors are retried;
+	// the zero value sends each probe once
+	Retry RetryPolicy
+	// HTTP2 lets the default transport offer h2 in the TLS handshake, so the
+	// negotiated ALPN reflects the server. Servers that accept it then get
+	// the probes over HTTP/2, which some WAFs inspect differently.
+	HTTP2 bool
+}
+
+// RetryPolicy controls how probes that fail with transient errors, such as
+// timeouts and connection resets, are retried. Responses are never retried,
+// whatever their status, since a 429 or 503 can be the WAF behavior a scan
+// looks for.
+type RetryPolicy struct {
+	// MaxRetries is how many times a probe is retried
+	MaxRetries int
+	// Backoff is the pause before the first retry; it doubles for each
+	// further retry
+	Backoff time.Duration
+	// MaxBackoff caps the pause; 0 leaves it uncapped
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy retries twice, after 500ms and 1s
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 2,
+		Backoff:    500 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+	}
+}
+
+// Validate checks that no limit is negative
+func (p RetryPolicy) Validate() error {
+	switch {
+	case p.MaxRetries < 0:
+		return fmt.Errorf("retries must not be negative, got %d", p.MaxRetries)
+	case p.Backoff < 0:
+		return fmt.Errorf("retry backoff must not be negative, got %v", p.Backoff)
+	case p.MaxBackoff < 0:
+		return fmt.Errorf("retry max backoff must not be negative, got %v", p.MaxBackoff)
+	}
+	return nil
+}
+
+// Delay returns the pause before the given retry, counted from 0
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	delay := p.Backoff
+	for i := 0; i < retry; i++ {
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// NewScanner creates a scanner from command-line configuration
 func NewScanner(config *cli.Config) *Scanner {
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		MaxIdleConns:    100,
-		IdleConnTimeout: 90 * time.Second,
+	opts := Options{
+		Timeout:   config.Timeout,
+		UserAgent: config.UserAgent,
+		Proxy:     config.Proxy,
+		HTTP2:     config.HTTP2,
+	}
+	if config.Debug && logger.Log != nil {
+		opts.Logger = logger.Log
+	}
+	opts.Retry = RetryPolicy{
+		MaxRetries: config.Retries,
+		Backoff:    config.RetryBackoff,
+		MaxBackoff: config.RetryMaxBackoff,
 	}
+	// Invalid limits are rejected by config.Validate
+	if limits := config.RateLimits(); limits.Enabled() {
+		if limiter, err := ratelimit.New(limits); err == nil {
+			opts.Limiter = limiter
+		}
+	}
+	return New(opts)
+}
 
-	if config.Proxy != "" {
-		proxyURL, err := url.Parse(config.Proxy)
-		if err == nil {
-			transport.Proxy = http.ProxyURL(proxyURL)
+// New creates a scanner from options
+func New(opts Options) *Scanner {
+	transport := opts.Transport
+	if transport == nil {
+		defaultTransport := &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: opts.HTTP2,
+			MaxIdleConns:      100,
+			IdleConnTimeout:   90 * time.Second,
 		}
+
+		if opts.Proxy != "" {
+			proxyURL, err := url.Parse(opts.Proxy)
+			if err == nil {
+				defaultTransport.Proxy = http.ProxyURL(proxyURL)
+			}
+		}
+		transport = defaultTransport
 	}
 
 	client := &http.Client{
 		Transport: transport,
-		Timeout:   config.Timeout,
+		Timeout:   opts.Timeout,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if len(via) >= 3 {
 				return http.ErrUseLastResponse
@@ -64,10 +286,26 @@ func NewScanner(config *cli.Config) *Scanner {
 
 	return &Scanner{
 		client: client,
-		config: config,
+		opts:   opts,
 	}
 }
 
+// AddProbes registers custom probes to run after the built-in ones
+func (s *Scanner) AddProbes(defs ...ProbeDefinition) error {
+	for _, def := range defs {
+		if err := def.Validate(); err != nil {
+			return err
+		}
+		for _, existing := range s.custom {
+			if existing.Name == def.Name {
+				return fmt.Errorf("duplicate probe %q", def.Name)
+			}
+		}
+		s.custom = append(s.custom, def)
+	}
+	return nil
+}
+
 func (s *Scanner) Scan(ctx context.Context, target string) (map[ProbeType]*ProbeResult, error) {
 	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
 		target = "https://" + target
@@ -75,16 +313,25 @@ func (s *Scanner) Scan(ctx context.Context, target string) (map[ProbeType]*Probe
 
 	results := make(map[ProbeType]*ProbeResult)
 
-	probes := []struct {
+	type probeFunc struct {
 		probeType ProbeType
 		fn        func(context.Context, string) *ProbeResult
-	}{
+	}
+
+	probes := []probeFunc{
 		{ProbeNormal, s.probeNormal},
 		{ProbeSQLi, s.probeSQLi},
 		{ProbeXSS, s.probeXSS},
 		{ProbeMalformed, s.probeMalformed},
 	}
 
+	for _, def := range s.custom {
+		def := def
+		probes = append(probes, probeFunc{def.Type(), func(ctx context.Context, target string) *ProbeResult {
+			return s.probeCustom(ctx, target, def)
+		}})
+	}
+
 	for _, probe := range probes {
 		select {
 		case <-ctx.Done():
@@ -92,9 +339,12 @@ func (s *Scanner) Scan(ctx context.Context, target string) (map[ProbeType]*Probe
 		default:
 			result := probe.fn(ctx, target)
 			results[probe.probeType] = result
+			if probe.probeType == ProbeNormal && result.Error == nil {
+				s.sampleBaseline(ctx, target, result)
+			}
 
-			if s.config.Debug {
-				fmt.Printf("[DEBUG] %s probe for %s: status=%d, length=%d, duration=%v\n",
+			if s.opts.Logger != nil {
+				s.opts.Logger.Debugf("%s probe for %s: status=%d, length=%d, duration=%v",
 					probe.probeType, target, result.StatusCode, result.BodyLength, result.Duration)
 			}
 		}
@@ -103,8 +353,23 @@ func (s *Scanner) Scan(ctx context.Context, target string) (map[ProbeType]*Probe
 	return results, nil
 }
 
+// sampleBaseline repeats the normal probe and records the bodies in
+// baseline.Samples; failed samples are skipped
+func (s *Scanner) sampleBaseline(ctx context.Context, target string, baseline *ProbeResult) {
+	for i := 1; i < s.opts.BaselineSamples; i++ {
+		if ctx.Err() != nil {
+			return
+		}
+		sample := s.probeNormal(ctx, target)
+		if sample.Error != nil || sample.StatusCode != baseline.StatusCode {
+			continue
+		}
+		baseline.Samples = append(baseline.Samples, sample.Body)
+	}
+}
+
 func (s *Scanner) probeNormal(ctx context.Context, target string) *ProbeResult {
-	return s.doRequest(ctx, ProbeNormal, target, "", nil)
+	return s.doRequest(ctx, ProbeNormal, http.MethodGet, target, "", nil)
 }
 
 func (s *Scanner) probeSQLi(ctx context.Context, target string) *ProbeResult {
@@ -118,7 +383,7 @@ func (s *Scanner) probeSQLi(ctx context.Context, target string) *ProbeResult {
 	q.Set("test", "' UNION SELECT NULL--")
 	u.RawQuery = q.Encode()
 
-	return s.doRequest(ctx, ProbeSQLi, u.String(), "", nil)
+	return s.doRequest(ctx, ProbeSQLi, http.MethodGet, u.String(), "", nil)
 }
 
 func (s *Scanner) probeXSS(ctx context.Context, target string) *ProbeResult {
@@ -132,7 +397,7 @@ func (s *Scanner) probeXSS(ctx context.Context, target string) *ProbeResult {
 	q.Set("search", "<img src=x onerror=alert(1)>")
 	u.RawQuery = q.Encode()
 
-	return s.doRequest(ctx, ProbeXSS, u.String(), "", nil)
+	return s.doRequest(ctx, ProbeXSS, http.MethodGet, u.String(), "", nil)
 }
 
 func (s *Scanner) probeMalformed(ctx context.Context, target string) *ProbeResult {
@@ -143,26 +408,126 @@ func (s *Scanner) probeMalformed(ctx context.Context, target string) *ProbeResul
 		"Cookie":          "session=<script>alert(1)</script>",
 	}
 
-	return s.doRequest(ctx, ProbeMalformed, target, "", headers)
+	return s.doRequest(ctx, ProbeMalformed, http.MethodGet, target, "", headers)
 }
 
-func (s *Scanner) doRequest(ctx context.Context, probeType ProbeType, target string, body string, headers map[string]string) *ProbeResult {
-	start := time.Now()
+func (s *Scanner) probeCustom(ctx context.Context, target string, def ProbeDefinition) *ProbeResult {
+	u, err := url.Parse(target)
+	if err != nil {
+		return &ProbeResult{Type: def.Type(), Error: err}
+	}
+
+	// Paths are applied verbatim rather than resolved so that dot segments in
+	// traversal payloads reach the target
+	if def.Path != "" {
+		ref, err := url.Parse(def.Path)
+		if err != nil {
+			return &ProbeResult{Type: def.Type(), Error: err}
+		}
+		if strings.HasPrefix(ref.Path, "/") {
+			u.Path, u.RawPath = ref.Path, ref.RawPath
+		} else {
+			base := strings.TrimSuffix(u.EscapedPath(), "/")
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/" + ref.Path
+			u.RawPath = base + "/" + ref.EscapedPath()
+		}
+		if ref.RawQuery != "" {
+			u.RawQuery = ref.RawQuery
+		}
+	}
+
+	if len(def.Query) > 0 {
+		q := u.Query()
+		for k, v := range def.Query {
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	headers := make(map[string]string, len(def.Headers)+1)
+	for k, v := range def.Headers {
+		headers[k] = v
+	}
+	if def.ContentType != "" {
+		headers["Content-Type"] = def.ContentType
+	}
+
+	method := strings.ToUpper(def.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	return s.doRequest(ctx, def.Type(), method, u.String(), def.Body, headers)
+}
+
+// doRequest sends a probe, retrying transient failures as the retry policy
+// allows
+func (s *Scanner) doRequest(ctx context.Context, probeType ProbeType, method, target, body string, headers map[string]string) *ProbeResult {
+	for retry := 0; ; retry++ {
+		result := s.send(ctx, probeType, method, target, body, headers)
+		if result.Error == nil || retry >= s.opts.Retry.MaxRetries || !waferrors.IsTransient(result.Error) {
+			return result
+		}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+		delay := s.opts.Retry.Delay(retry)
+		if s.opts.Logger != nil {
+			s.opts.Logger.Debugf("%s probe for %s failed, retrying in %v: %v", probeType, target, delay, result.Error)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return result
+		}
+	}
+}
+
+// send sends a probe once. Failures are classified as errors.WAFError.
+func (s *Scanner) send(ctx context.Context, probeType ProbeType, method, target, body string, headers map[string]string) *ProbeResult {
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
 	if err != nil {
 		return &ProbeResult{
 			Type:  probeType,
-			Error: err,
+			Error: waferrors.Classify(target, err),
 		}
 	}
 
-	req.Header.Set("User-Agent", s.config.UserAgent)
+	if s.opts.UserAgent != "" {
+		req.Header.Set("User-Agent", s.opts.UserAgent)
+	}
 
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
 
+	sent := &ProbeRequest{
+		Method:  method,
+		URL:     req.URL.String(),
+		Headers: req.Header.Clone(),
+		Body:    body,
+	}
+
+	if s.opts.Limiter != nil {
+		release, err := s.opts.Limiter.Wait(ctx, req.URL.Hostname())
+		if err != nil {
+			return &ProbeResult{
+				Type:    probeType,
+				Error:   waferrors.Classify(target, err),
+				Request: sent,
+			}
+		}
+		// Held until the body is read, so MaxPerHost covers the whole exchange
+		defer release()
+	}
+
+	// Time spent waiting for the limiter is not part of the response time
+	start := time.Now()
 	resp, err := s.client.Do(req)
 	duration := time.Since(start)
 
@@ -170,11 +535,18 @@ func (s *Scanner) doRequest(ctx context.Context, probeType ProbeType, target str
 		return &ProbeResult{
 			Type:     probeType,
 			Duration: duration,
-			Error:    err,
+			Error:    waferrors.Classify(target, err),
+			Request:  sent,
 		}
 	}
 	defer resp.Body.Close()
 
+	// Custom transports may leave the request unset
+	finalURL := req.URL.String()
+	if resp.Request != nil {
+		finalURL = resp.Request.URL.String()
+	}
+
 	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
 	if err != nil {
 		return &ProbeResult{
@@ -182,7 +554,10 @@ func (s *Scanner) doRequest(ctx context.Context, probeType ProbeType, target str
 			StatusCode: resp.StatusCode,
 			Headers:    resp.Header,
 			Duration:   duration,
-			Error:      err,
+			Error:      waferrors.Classify(target, err),
+			URL:        finalURL,
+			Request:    sent,
+			TLS:        newTLSInfo(resp.TLS),
 		}
 	}
 
@@ -193,5 +568,8 @@ func (s *Scanner) doRequest(ctx context.Context, probeType ProbeType, target str
 		Body:       string(bodyBytes),
 		BodyLength: len(bodyBytes),
 		Duration:   duration,
+		URL:        finalURL,
+		Request:    sent,
+		TLS:        newTLSInfo(resp.TLS),
 	}
 }
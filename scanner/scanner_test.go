@@ -2,10 +2,22 @@ package scanner
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/ahmedtouahria/waf-detector/cli"
+	waferrors "github.com/ahmedtouahria/waf-detector/errors"
+	"github.com/ahmedtouahria/waf-detector/ratelimit"
 )
 
 func TestNewScanner(t *testing.T) {
@@ -22,6 +34,14 @@ func TestNewScanner(t *testing.T) {
 }
 
 func TestScan(t *testing.T) {
+	// Targets without a scheme default to https, so serve TLS; the scanner
+	// does not verify certificates
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>Welcome</html>")
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
 	tests := []struct {
 		name      string
 		baseURL   string
@@ -29,17 +49,12 @@ func TestScan(t *testing.T) {
 	}{
 		{
 			name:      "Valid HTTPS URL",
-			baseURL:   "https://example.com",
-			wantError: false,
-		},
-		{
-			name:      "Valid HTTP URL",
-			baseURL:   "http://example.com",
+			baseURL:   server.URL,
 			wantError: false,
 		},
 		{
 			name:      "URL without scheme",
-			baseURL:   "example.com",
+			baseURL:   host,
 			wantError: false,
 		},
 	}
@@ -51,36 +66,99 @@ func TestScan(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := s.Scan(ctx, tt.baseURL)
+			results, err := s.Scan(ctx, tt.baseURL)
 			if (err != nil) != tt.wantError {
 				t.Errorf("Scan() error = %v, wantError %v", err, tt.wantError)
 			}
+			for _, probe := range BuiltinProbeTypes() {
+				if result := results[probe]; result == nil || result.Error != nil || result.StatusCode != http.StatusOK {
+					t.Errorf("%s probe = %+v, want 200", probe, result)
+				}
+			}
+			if req := results[ProbeMalformed].Request; req == nil || req.Method != http.MethodGet || req.Headers.Get("Referer") != "javascript:alert(1)" {
+				t.Errorf("malformed probe request = %+v, want the GET with its payload headers", req)
+			}
 		})
 	}
 }
 
-func TestScanInvalidURL(t *testing.T) {
-	config := &cli.Config{
-		Timeout: 1 * time.Second, // Short timeout
+func TestScanTLS(t *testing.T) {
+	var protos sync.Map
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos.Store(r.Proto, true)
+		fmt.Fprint(w, "<html>Welcome</html>")
+	})
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	plainServer := httptest.NewServer(handler)
+	defer plainServer.Close()
+
+	tests := []struct {
+		name      string
+		http2     bool
+		wantALPN  string
+		wantProto string
+	}{
+		// HTTP/2 is opt-in, so the probes WAFs see do not change by default
+		{"default", false, "", "HTTP/1.1"},
+		{"http2", true, "h2", "HTTP/2.0"},
 	}
-	s := NewScanner(config)
-	ctx := context.Background()
 
-	// Test with URL that will definitely fail - non-existent domain
-	results, _ := s.Scan(ctx, "https://this-domain-definitely-does-not-exist-12345.com")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protos = sync.Map{}
+			s := New(Options{Timeout: 5 * time.Second, HTTP2: tt.http2})
+
+			results, err := s.Scan(context.Background(), tlsServer.URL)
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			info := results[ProbeNormal].TLS
+			if info == nil {
+				t.Fatal("normal probe over https has no TLS details")
+			}
+			if info.Version == "" || info.CipherSuite == "" || info.ALPN != tt.wantALPN {
+				t.Errorf("TLS = %+v, want a version, a cipher suite and ALPN %q", info, tt.wantALPN)
+			}
+			// httptest serves a certificate for example.com issued by Acme Co
+			if !strings.Contains(info.Issuer, "O=Acme Co") || len(info.SANs) == 0 || info.SANs[0] != "example.com" {
+				t.Errorf("TLS = %+v, want the httptest certificate", info)
+			}
+			protos.Range(func(proto, _ any) bool {
+				if proto != tt.wantProto {
+					t.Errorf("server received %s probes, want only %s", proto, tt.wantProto)
+				}
+				return true
+			})
 
-	// At least one probe should have an error
-	hasError := false
-	for _, result := range results {
-		if result.Error != nil {
-			hasError = true
-			break
-		}
+			results, err = s.Scan(context.Background(), plainServer.URL)
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if info := results[ProbeNormal].TLS; info != nil {
+				t.Errorf("TLS over plain http = %+v, want nil", info)
+			}
+		})
 	}
+}
+
+func TestScanUnreachable(t *testing.T) {
+	// A closed server leaves a port that refuses connections
+	server := httptest.NewServer(http.NotFoundHandler())
+	target := server.URL
+	server.Close()
 
-	if !hasError {
-		t.Log("Warning: Expected at least one probe to fail for non-existent domain")
-		// Don't fail the test since network conditions vary
+	s := NewScanner(&cli.Config{Timeout: time.Second})
+	results, err := s.Scan(context.Background(), target)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	for _, probe := range BuiltinProbeTypes() {
+		if result := results[probe]; result == nil || result.Error == nil {
+			t.Errorf("%s probe = %+v, want a connection error", probe, result)
+		}
 	}
 }
 
@@ -103,3 +181,224 @@ func TestProbeTypeString(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomProbe(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/graphql" {
+			body, _ := io.ReadAll(r.Body)
+			got, gotBody = r, string(body)
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	s := NewScanner(&cli.Config{Timeout: 5 * time.Second})
+	err := s.AddProbes(ProbeDefinition{
+		Name:        "graphql",
+		Method:      "post",
+		Path:        "/graphql",
+		Query:       map[string]string{"op": "introspect"},
+		Headers:     map[string]string{"X-Test": "1"},
+		Body:        `{"query":"{__schema{types{name}}}"}`,
+		ContentType: "application/json",
+	})
+	if err != nil {
+		t.Fatalf("AddProbes failed: %v", err)
+	}
+
+	results, err := s.Scan(context.Background(), server.URL+"/app")
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	result := results[ProbeType("graphql")]
+	if result == nil || result.StatusCode != http.StatusForbidden {
+		t.Fatalf("custom probe result = %+v, want status 403", result)
+	}
+	if got == nil {
+		t.Fatal("custom probe request not received")
+	}
+	if got.Method != http.MethodPost {
+		t.Errorf("Method = %s, want POST", got.Method)
+	}
+	if got.URL.Query().Get("op") != "introspect" {
+		t.Errorf("query op = %q, want introspect", got.URL.Query().Get("op"))
+	}
+	if got.Header.Get("X-Test") != "1" || got.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers: %v", got.Header)
+	}
+	if !strings.Contains(gotBody, "__schema") {
+		t.Errorf("body = %q", gotBody)
+	}
+}
+
+func TestAddProbesValidation(t *testing.T) {
+	s := NewScanner(&cli.Config{Timeout: time.Second})
+
+	tests := []struct {
+		name string
+		def  ProbeDefinition
+	}{
+		{"missing name", ProbeDefinition{Path: "/"}},
+		{"built-in name", ProbeDefinition{Name: "sqli"}},
+		{"bad method", ProbeDefinition{Name: "odd", Method: "BREW"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.AddProbes(tt.def); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+
+	if err := s.AddProbes(ProbeDefinition{Name: "xxe"}, ProbeDefinition{Name: "xxe"}); err == nil {
+		t.Error("expected duplicate probe error")
+	}
+}
+
+func TestBaselineSamples(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "" || r.Header.Get("Referer") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		requests++
+		fmt.Fprintf(w, "<html>Welcome, visitor %d</html>", requests)
+	}))
+	defer server.Close()
+
+	s := New(Options{Timeout: 5 * time.Second, BaselineSamples: 3})
+	results, err := s.Scan(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	normal := results[ProbeNormal]
+	if requests != 3 {
+		t.Errorf("normal probe sent %d times, want 3", requests)
+	}
+	if normal.Body != "<html>Welcome, visitor 1</html>" {
+		t.Errorf("Body = %q, want the first response", normal.Body)
+	}
+	want := []string{"<html>Welcome, visitor 2</html>", "<html>Welcome, visitor 3</html>"}
+	if strings.Join(normal.Samples, "|") != strings.Join(want, "|") {
+		t.Errorf("Samples = %q, want %q", normal.Samples, want)
+	}
+	if normal.URL != server.URL {
+		t.Errorf("URL = %q, want %q", normal.URL, server.URL)
+	}
+}
+
+func TestScanRateLimit(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	limiter, err := ratelimit.New(ratelimit.Limits{Delay: 20 * time.Millisecond, MaxPerHost: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(Options{Timeout: 5 * time.Second, Limiter: limiter})
+
+	// Two scans of the same host share its limits
+	start := time.Now()
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := s.Scan(context.Background(), server.URL)
+			done <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+	}
+
+	// 8 requests to one host, at least 20ms apart
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("scans took %v, want at least 140ms", elapsed)
+	}
+	if maxInFlight != 1 {
+		t.Errorf("%d requests in flight at once, want 1", maxInFlight)
+	}
+}
+
+// flakyTransport fails the first failures requests with err
+type flakyTransport struct {
+	failures int32
+	err      error
+	calls    int32
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if atomic.AddInt32(&f.calls, 1) <= f.failures {
+		return nil, f.err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("ok")),
+		Request:    req,
+	}, nil
+}
+
+func TestRetry(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	policy := RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond}
+
+	tests := []struct {
+		name      string
+		transport *flakyTransport
+		policy    RetryPolicy
+		wantCalls int32
+		wantType  waferrors.ErrorType
+	}{
+		{"transient error retried", &flakyTransport{failures: 2, err: reset}, policy, 3, ""},
+		{"retries exhausted", &flakyTransport{failures: 5, err: reset}, policy, 3, waferrors.ErrorTypeConnectionReset},
+		{"permanent error not retried", &flakyTransport{failures: 5, err: refused}, policy, 1, waferrors.ErrorTypeConnectionRefused},
+		{"retries disabled", &flakyTransport{failures: 1, err: reset}, RetryPolicy{}, 1, waferrors.ErrorTypeConnectionReset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Options{Transport: tt.transport, Retry: tt.policy})
+			result := s.probeNormal(context.Background(), "https://example.com")
+
+			if tt.transport.calls != tt.wantCalls {
+				t.Errorf("sent %d requests, want %d", tt.transport.calls, tt.wantCalls)
+			}
+			if got := waferrors.TypeOf(result.Error); got != tt.wantType {
+				t.Errorf("error type = %q (%v), want %q", got, result.Error, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Backoff: 500 * time.Millisecond, MaxBackoff: 3 * time.Second}
+	want := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+	for retry, w := range want {
+		if got := policy.Delay(retry); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", retry, got, w)
+		}
+	}
+	if err := (RetryPolicy{MaxRetries: -1}).Validate(); err == nil {
+		t.Error("Validate() should reject negative retries")
+	}
+}
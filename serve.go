@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ahmedtouahria/waf-detector/cli"
+	"github.com/ahmedtouahria/waf-detector/logger"
+	"github.com/ahmedtouahria/waf-detector/output"
+	"github.com/ahmedtouahria/waf-detector/server"
+)
+
+// runServe starts the REST API server and blocks until interrupted
+func runServe(args []string) {
+	config := loadConfig(cli.ParseArgs("waf-detector serve", args))
+
+	logger.Init(config.Debug, config.Silent)
+
+	client := newClient(config)
+	srv := server.New(func(ctx context.Context, target string) output.Result {
+		result, _ := client.Detect(ctx, target)
+		return result
+	}, config.Threads)
+	srv.Start()
+
+	httpServer := &http.Server{
+		Addr:              config.Listen,
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		logger.Info("Interrupt received, shutting down...")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			logger.Errorf("Error shutting down server: %v", err)
+		}
+	}()
+
+	logger.Infof("waf-detector %s API listening on %s with %d workers", Version, config.Listen, config.Threads)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatalf("Error starting server: %v", err)
+	}
+
+	srv.Close()
+}
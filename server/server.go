@@ -0,0 +1,412 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahmedtouahria/waf-detector/output"
+)
+
+const (
+	// MaxTargetsPerJob caps the size of a single batch submission
+	MaxTargetsPerJob = 10000
+
+	// MaxActiveJobs caps the jobs queued or running at once
+	MaxActiveJobs = 16
+
+	// maxRequestBody caps the size of a job submission body
+	maxRequestBody = 4 << 20
+
+	// jobRetention is how long finished jobs are kept for polling
+	jobRetention = time.Hour
+)
+
+// ErrTooManyJobs is returned by Submit while MaxActiveJobs jobs are queued
+// or running
+var ErrTooManyJobs = errors.New("too many active jobs")
+
+// ScanFunc scans a single target and returns its result
+type ScanFunc func(ctx context.Context, target string) output.Result
+
+// JobStatus is the lifecycle state of a scan job
+type JobStatus string
+
+const (
+	StatusQueued    JobStatus = "queued"
+	StatusRunning   JobStatus = "running"
+	StatusCompleted JobStatus = "completed"
+	StatusCancelled JobStatus = "cancelled"
+)
+
+// Job is a batch of targets submitted in one request
+type Job struct {
+	ID         string
+	Status     JobStatus
+	Targets    []string
+	Results    []*output.Result
+	Completed  int
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// JobView is the JSON representation of a job's progress
+type JobView struct {
+	ID         string     `json:"id"`
+	Status     JobStatus  `json:"status"`
+	Total      int        `json:"total"`
+	Completed  int        `json:"completed"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ScanRequest is the body accepted when submitting a job
+type ScanRequest struct {
+	URL  string   `json:"url,omitempty"`
+	URLs []string `json:"urls,omitempty"`
+}
+
+// task is a single target of a job waiting for a worker
+type task struct {
+	job   *Job
+	index int
+}
+
+// Server runs scan jobs submitted over HTTP on a bounded pool of workers
+type Server struct {
+	scan    ScanFunc
+	workers int
+	tasks   chan task
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a server that scans targets with scan on the given number of workers
+func New(scan ScanFunc, workers int) *Server {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		scan:    scan,
+		workers: workers,
+		tasks:   make(chan task, workers),
+		jobs:    make(map[string]*Job),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start launches the worker pool
+func (s *Server) Start() {
+	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+}
+
+// Close cancels all jobs and waits for the workers to stop
+func (s *Server) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Handler returns the HTTP API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("POST /api/v1/scans", s.handleCreate)
+	mux.HandleFunc("GET /api/v1/scans", s.handleList)
+	mux.HandleFunc("GET /api/v1/scans/{id}", s.handleStatus)
+	mux.HandleFunc("GET /api/v1/scans/{id}/results", s.handleResults)
+	mux.HandleFunc("DELETE /api/v1/scans/{id}", s.handleCancel)
+	return mux
+}
+
+// Submit queues a job for the given targets
+func (s *Server) Submit(targets []string) (*Job, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets specified")
+	}
+	if len(targets) > MaxTargetsPerJob {
+		return nil, fmt.Errorf("too many targets: %d (max %d)", len(targets), MaxTargetsPerJob)
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	job := &Job{
+		ID:        id,
+		Status:    StatusQueued,
+		Targets:   targets,
+		Results:   make([]*output.Result, len(targets)),
+		CreatedAt: time.Now(),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	s.mu.Lock()
+	s.pruneLocked()
+	if s.activeLocked() >= MaxActiveJobs {
+		s.mu.Unlock()
+		cancel()
+		return nil, fmt.Errorf("%w (max %d); retry once a job finishes", ErrTooManyJobs, MaxActiveJobs)
+	}
+	s.jobs[id] = job
+	s.mu.Unlock()
+
+	// Feed targets to the pool without blocking the request
+	go func() {
+		for i := range targets {
+			select {
+			case s.tasks <- task{job: job, index: i}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return job, nil
+}
+
+// Cancel stops a job; targets already scanned keep their results
+func (s *Server) Cancel(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, false
+	}
+
+	if job.Status == StatusQueued || job.Status == StatusRunning {
+		job.Status = StatusCancelled
+		job.FinishedAt = time.Now()
+		job.cancel()
+	}
+	return job, true
+}
+
+func (s *Server) worker() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case t := <-s.tasks:
+			s.run(t)
+		}
+	}
+}
+
+func (s *Server) run(t task) {
+	job := t.job
+
+	s.mu.Lock()
+	if job.ctx.Err() != nil {
+		s.mu.Unlock()
+		return
+	}
+	if job.Status == StatusQueued {
+		job.Status = StatusRunning
+		job.StartedAt = time.Now()
+	}
+	s.mu.Unlock()
+
+	result := s.scan(job.ctx, job.Targets[t.index])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A scan interrupted by cancellation is not a real result
+	if job.ctx.Err() != nil {
+		return
+	}
+
+	job.Results[t.index] = &result
+	job.Completed++
+	if job.Completed == len(job.Targets) {
+		job.Status = StatusCompleted
+		job.FinishedAt = time.Now()
+		job.cancel()
+	}
+}
+
+// activeLocked counts the jobs that are queued or running
+func (s *Server) activeLocked() int {
+	active := 0
+	for _, job := range s.jobs {
+		if job.Status == StatusQueued || job.Status == StatusRunning {
+			active++
+		}
+	}
+	return active
+}
+
+// pruneLocked drops finished jobs older than the retention period
+func (s *Server) pruneLocked() {
+	cutoff := time.Now().Add(-jobRetention)
+	for id, job := range s.jobs {
+		if !job.FinishedAt.IsZero() && job.FinishedAt.Before(cutoff) {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req ScanRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	var targets []string
+	for _, target := range append([]string{req.URL}, req.URLs...) {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+
+	job, err := s.Submit(targets)
+	if errors.Is(err, ErrTooManyJobs) {
+		writeError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/scans/"+job.ID)
+	writeJSON(w, http.StatusAccepted, s.view(job))
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	views := make([]JobView, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		views = append(views, s.viewLocked(job))
+	}
+	s.mu.Unlock()
+
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].CreatedAt.Before(views[j].CreatedAt)
+	})
+	writeJSON(w, http.StatusOK, map[string][]JobView{"jobs": views})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.view(job))
+}
+
+func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	s.mu.Lock()
+	results := make([]output.Result, 0, job.Completed)
+	for _, result := range job.Results {
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, output.NewJSONOutput(results))
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.Cancel(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.view(job))
+}
+
+func (s *Server) job(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+func (s *Server) view(job *Job) JobView {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.viewLocked(job)
+}
+
+func (s *Server) viewLocked(job *Job) JobView {
+	view := JobView{
+		ID:        job.ID,
+		Status:    job.Status,
+		Total:     len(job.Targets),
+		Completed: job.Completed,
+		CreatedAt: job.CreatedAt,
+	}
+	if !job.StartedAt.IsZero() {
+		started := job.StartedAt
+		view.StartedAt = &started
+	}
+	if !job.FinishedAt.IsZero() {
+		finished := job.FinishedAt
+		view.FinishedAt = &finished
+	}
+	return view
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedtouahria/waf-detector/output"
+)
+
+func newTestServer(t *testing.T, scan ScanFunc) *httptest.Server {
+	t.Helper()
+
+	srv := New(scan, 2)
+	srv.Start()
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		srv.Close()
+	})
+	return ts
+}
+
+func postJSON(t *testing.T, url, body string) (*http.Response, JobView) {
+	t.Helper()
+
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var view JobView
+	_ = json.NewDecoder(resp.Body).Decode(&view)
+	return resp, view
+}
+
+func getJSON(t *testing.T, url string, v interface{}) int {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func waitForStatus(t *testing.T, url string, want JobStatus) JobView {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var view JobView
+		getJSON(t, url, &view)
+		if view.Status == want {
+			return view
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job status = %s, want %s", view.Status, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBatchJob(t *testing.T) {
+	ts := newTestServer(t, func(ctx context.Context, target string) output.Result {
+		return output.Result{URL: target, WAFFound: true, WAFName: "TestWAF"}
+	})
+
+	resp, view := postJSON(t, ts.URL+"/api/v1/scans", `{"urls": ["https://a.example", "https://b.example", " "]}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", resp.StatusCode)
+	}
+	if view.Total != 2 {
+		t.Errorf("Total = %d, want 2", view.Total)
+	}
+
+	done := waitForStatus(t, ts.URL+"/api/v1/scans/"+view.ID, StatusCompleted)
+	if done.Completed != 2 || done.FinishedAt == nil {
+		t.Errorf("completed job = %+v", done)
+	}
+
+	var results output.JSONOutput
+	getJSON(t, ts.URL+"/api/v1/scans/"+view.ID+"/results", &results)
+	if len(results.Results) != 2 || results.Results[0].URL != "https://a.example" {
+		t.Errorf("results = %+v", results.Results)
+	}
+	if results.Summary.WAFsDetected != 2 {
+		t.Errorf("WAFsDetected = %d, want 2", results.Summary.WAFsDetected)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	ts := newTestServer(t, func(ctx context.Context, target string) output.Result {
+		<-ctx.Done()
+		return output.Result{URL: target, Error: ctx.Err().Error()}
+	})
+
+	_, view := postJSON(t, ts.URL+"/api/v1/scans", `{"url": "https://slow.example"}`)
+	waitForStatus(t, ts.URL+"/api/v1/scans/"+view.ID, StatusRunning)
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/scans/"+view.ID, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("DELETE status = %d, want 200", resp.StatusCode)
+	}
+
+	cancelled := waitForStatus(t, ts.URL+"/api/v1/scans/"+view.ID, StatusCancelled)
+	if cancelled.Completed != 0 {
+		t.Errorf("cancelled job should have no results, got %d", cancelled.Completed)
+	}
+}
+
+func TestTooManyJobs(t *testing.T) {
+	ts := newTestServer(t, func(ctx context.Context, target string) output.Result {
+		<-ctx.Done()
+		return output.Result{URL: target, Error: ctx.Err().Error()}
+	})
+
+	var first JobView
+	for i := 0; i < MaxActiveJobs; i++ {
+		resp, view := postJSON(t, ts.URL+"/api/v1/scans", `{"url": "https://slow.example"}`)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("job %d: status = %d, want 202", i, resp.StatusCode)
+		}
+		if i == 0 {
+			first = view
+		}
+	}
+
+	resp, _ := postJSON(t, ts.URL+"/api/v1/scans", `{"url": "https://slow.example"}`)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status with %d active jobs = %d, want 429", MaxActiveJobs, resp.StatusCode)
+	}
+
+	// Cancelling a job frees its place
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/scans/"+first.ID, nil)
+	cancelResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelResp.Body.Close()
+
+	if resp, _ := postJSON(t, ts.URL+"/api/v1/scans", `{"url": "https://slow.example"}`); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("status after cancelling a job = %d, want 202", resp.StatusCode)
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	ts := newTestServer(t, func(ctx context.Context, target string) output.Result {
+		return output.Result{URL: target}
+	})
+
+	for _, body := range []string{`{}`, `not json`, `{"target": "x"}`} {
+		resp, _ := postJSON(t, ts.URL+"/api/v1/scans", body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("body %q: status = %d, want 400", body, resp.StatusCode)
+		}
+	}
+
+	var errBody map[string]string
+	if status := getJSON(t, ts.URL+"/api/v1/scans/missing", &errBody); status != http.StatusNotFound {
+		t.Errorf("unknown job status = %d, want 404", status)
+	}
+}
@@ -0,0 +1,69 @@
+package signatures
+
+import (
+	"net/http"
+	"strings"
+)
+
+// cookie is a single parsed Set-Cookie header
+type cookie struct {
+	Name  string
+	Value string
+	// Attributes holds attribute values keyed by lower-cased name; flags
+	// such as Secure and HttpOnly map to an empty value
+	Attributes map[string]string
+}
+
+// parseSetCookies parses every Set-Cookie header of a response. Headers
+// without a name=value pair are skipped, as browsers do.
+func parseSetCookies(headers http.Header) []cookie {
+	var cookies []cookie
+	for _, line := range headers.Values("Set-Cookie") {
+		parts := strings.Split(line, ";")
+
+		name, value, ok := strings.Cut(parts[0], "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+
+		c := cookie{
+			Name:       name,
+			Value:      strings.TrimSpace(value),
+			Attributes: make(map[string]string, len(parts)-1),
+		}
+		for _, part := range parts[1:] {
+			key, val, _ := strings.Cut(part, "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			if key == "" {
+				continue
+			}
+			c.Attributes[key] = strings.TrimSpace(val)
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies
+}
+
+// matchCookieName reports whether a cookie name is selected by the
+// indicator's key. An empty key selects every cookie.
+func (ind *Indicator) matchCookieName(name string) bool {
+	if ind.Key == "" {
+		return true
+	}
+
+	switch ind.Match {
+	case KeyMatchExact:
+		if ind.CaseInsensitive {
+			return strings.EqualFold(name, ind.Key)
+		}
+		return name == ind.Key
+	case KeyMatchRegex:
+		return ind.keyPattern != nil && ind.keyPattern.MatchString(name)
+	default:
+		if ind.CaseInsensitive {
+			return strings.HasPrefix(strings.ToLower(name), strings.ToLower(ind.Key))
+		}
+		return strings.HasPrefix(name, ind.Key)
+	}
+}
@@ -0,0 +1,226 @@
+package signatures
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ahmedtouahria/waf-detector/scanner"
+)
+
+// KeywordBaseline defines how block keywords are compared with the baseline
+type KeywordBaseline string
+
+const (
+	// KeywordBaselineStatus counts a keyword only when the probe's status
+	// differs from the baseline's
+	KeywordBaselineStatus KeywordBaseline = "status"
+	// KeywordBaselineBody counts a keyword whenever the baseline body does not
+	// contain it, which catches challenge pages served with the same status
+	KeywordBaselineBody KeywordBaseline = "body"
+)
+
+// DetectionPolicy decides when a probe response looks blocked. The detector
+// only fingerprints a target once MinBlockedProbes of Probes look blocked.
+// In YAML it is the detection section of a signatures file; fields that are
+// not set keep their earlier or default value.
+type DetectionPolicy struct {
+	// Probes are the probes checked for blocking, compared with the normal probe
+	Probes           []string `yaml:"probes,omitempty"`
+	MinBlockedProbes int      `yaml:"min_blocked_probes,omitempty"`
+
+	// BlockStatusCodes always count as blocked. ServerErrors counts a 5xx
+	// response as blocked when the baseline succeeded.
+	BlockStatusCodes []int `yaml:"block_status_codes,omitempty"`
+	ServerErrors     *bool `yaml:"server_errors,omitempty"`
+
+	// Keywords count as blocked when the body contains one, ignoring case,
+	// and KeywordBaseline holds
+	Keywords        []string        `yaml:"keywords,omitempty"`
+	KeywordBaseline KeywordBaseline `yaml:"keyword_baseline,omitempty"`
+
+	// BlockRedirects count a probe as blocked when its Location header, or
+	// the URL it was redirected to, contains one of them and the baseline's
+	// does not
+	BlockRedirects []string `yaml:"block_redirects,omitempty"`
+
+	// MinSimilarity counts a probe answered with the baseline's status as
+	// blocked when its BaselineSimilarity is lower; 0 turns the check off.
+	// BaselineSamples is how many times the normal probe is sent to learn
+	// which parts of the page change between requests.
+	MinSimilarity   *float64 `yaml:"min_similarity,omitempty"`
+	BaselineSamples int      `yaml:"baseline_samples,omitempty"`
+}
+
+// maxBaselineSamples bounds the extra requests sent to every target
+const maxBaselineSamples = 10
+
+// DefaultDetectionPolicy returns the policy used when signature files do not
+// set one
+func DefaultDetectionPolicy() DetectionPolicy {
+	serverErrors := true
+	minSimilarity := 0.5
+	return DetectionPolicy{
+		Probes:           []string{string(scanner.ProbeSQLi), string(scanner.ProbeXSS), string(scanner.ProbeMalformed)},
+		MinBlockedProbes: 2,
+		BlockStatusCodes: []int{403, 406, 419, 429},
+		ServerErrors:     &serverErrors,
+		Keywords: []string{
+			"blocked", "forbidden", "access denied", "security",
+			"firewall", "not acceptable", "rejected", "suspicious",
+		},
+		KeywordBaseline: KeywordBaselineStatus,
+		MinSimilarity:   &minSimilarity,
+		BaselineSamples: 2,
+	}
+}
+
+// merge returns p with the fields set in other replacing its own
+func (p DetectionPolicy) merge(other DetectionPolicy) DetectionPolicy {
+	if other.Probes != nil {
+		p.Probes = other.Probes
+	}
+	if other.MinBlockedProbes != 0 {
+		p.MinBlockedProbes = other.MinBlockedProbes
+	}
+	if other.BlockStatusCodes != nil {
+		p.BlockStatusCodes = other.BlockStatusCodes
+	}
+	if other.ServerErrors != nil {
+		p.ServerErrors = other.ServerErrors
+	}
+	if other.Keywords != nil {
+		p.Keywords = other.Keywords
+	}
+	if other.KeywordBaseline != "" {
+		p.KeywordBaseline = other.KeywordBaseline
+	}
+	if other.BlockRedirects != nil {
+		p.BlockRedirects = other.BlockRedirects
+	}
+	if other.MinSimilarity != nil {
+		p.MinSimilarity = other.MinSimilarity
+	}
+	if other.BaselineSamples != 0 {
+		p.BaselineSamples = other.BaselineSamples
+	}
+	return p
+}
+
+// validate checks the fields that are set; knownProbes holds the built-in and
+// custom probe names
+func (p DetectionPolicy) validate(knownProbes map[string]bool) error {
+	for _, probe := range p.Probes {
+		if probe == string(scanner.ProbeNormal) {
+			return fmt.Errorf("detection probes cannot include the %s baseline probe", probe)
+		}
+		if !knownProbes[probe] {
+			return fmt.Errorf("unknown detection probe %q", probe)
+		}
+	}
+	if p.MinBlockedProbes < 0 {
+		return fmt.Errorf("min_blocked_probes must not be negative")
+	}
+	if p.Probes != nil && p.MinBlockedProbes > len(p.Probes) {
+		return fmt.Errorf("min_blocked_probes %d is unreachable with %d detection probes", p.MinBlockedProbes, len(p.Probes))
+	}
+	for _, code := range p.BlockStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid block status code %d", code)
+		}
+	}
+	for _, keyword := range p.Keywords {
+		if strings.TrimSpace(keyword) == "" {
+			return fmt.Errorf("empty block keyword")
+		}
+	}
+	switch p.KeywordBaseline {
+	case "", KeywordBaselineStatus, KeywordBaselineBody:
+	default:
+		return fmt.Errorf("unknown keyword_baseline %q (use status or body)", p.KeywordBaseline)
+	}
+	for _, redirect := range p.BlockRedirects {
+		if redirect == "" {
+			return fmt.Errorf("empty block redirect")
+		}
+	}
+	if p.MinSimilarity != nil && (*p.MinSimilarity < 0 || *p.MinSimilarity > 1) {
+		return fmt.Errorf("min_similarity %v is outside 0..1", *p.MinSimilarity)
+	}
+	if p.BaselineSamples < 0 || p.BaselineSamples > maxBaselineSamples {
+		return fmt.Errorf("baseline_samples must be between 0 and %d, got %d", maxBaselineSamples, p.BaselineSamples)
+	}
+	return nil
+}
+
+// Blocked reports whether probe looks blocked compared with baseline
+func (p DetectionPolicy) Blocked(probe, baseline *scanner.ProbeResult) bool {
+	for _, code := range p.BlockStatusCodes {
+		if probe.StatusCode == code {
+			return true
+		}
+	}
+
+	if p.ServerErrors != nil && *p.ServerErrors &&
+		probe.StatusCode >= 500 && probe.StatusCode <= 599 && baseline.StatusCode < 400 {
+		return true
+	}
+
+	if p.redirected(probe, baseline) {
+		return true
+	}
+
+	if p.diverged(probe, baseline) {
+		return true
+	}
+
+	if p.KeywordBaseline != KeywordBaselineBody && probe.StatusCode == baseline.StatusCode {
+		return false
+	}
+	bodyLower := strings.ToLower(probe.Body)
+	baselineLower := strings.ToLower(baseline.Body)
+	for _, keyword := range p.Keywords {
+		keyword = strings.ToLower(keyword)
+		if !strings.Contains(bodyLower, keyword) {
+			continue
+		}
+		if p.KeywordBaseline == KeywordBaselineBody && strings.Contains(baselineLower, keyword) {
+			continue
+		}
+		return true
+	}
+
+	return false
+}
+
+// diverged reports whether the probe got a different page than the baseline
+// with the same status, such as a challenge page served with a 200
+func (p DetectionPolicy) diverged(probe, baseline *scanner.ProbeResult) bool {
+	if p.MinSimilarity == nil || *p.MinSimilarity == 0 {
+		return false
+	}
+	if probe.StatusCode != baseline.StatusCode || baseline.Body == "" {
+		return false
+	}
+	return BaselineSimilarity(probe, baseline) < *p.MinSimilarity
+}
+
+// redirected reports whether the probe was sent to a block URL the baseline
+// was not
+func (p DetectionPolicy) redirected(probe, baseline *scanner.ProbeResult) bool {
+	targets := func(r *scanner.ProbeResult) string {
+		location := ""
+		if r.Headers != nil {
+			location = r.Headers.Get("Location")
+		}
+		return strings.ToLower(location + " " + r.URL)
+	}
+
+	probeTarget, baselineTarget := targets(probe), targets(baseline)
+	for _, redirect := range p.BlockRedirects {
+		redirect = strings.ToLower(redirect)
+		if strings.Contains(probeTarget, redirect) && !strings.Contains(baselineTarget, redirect) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package signatures
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ahmedtouahria/waf-detector/scanner"
+)
+
+func TestDetectionPolicyBlocked(t *testing.T) {
+	page := func(status int, body string) *scanner.ProbeResult {
+		return &scanner.ProbeResult{StatusCode: status, Headers: http.Header{}, Body: body}
+	}
+	redirect := func(location string) *scanner.ProbeResult {
+		return &scanner.ProbeResult{StatusCode: 302, Headers: http.Header{"Location": {location}}}
+	}
+
+	off := 0.0
+	noSimilarity := DefaultDetectionPolicy().merge(DetectionPolicy{MinSimilarity: &off})
+	challenge := DefaultDetectionPolicy().merge(DetectionPolicy{
+		Keywords:        []string{"verify you are human", "Zugriff verweigert", "访问被拒绝"},
+		KeywordBaseline: KeywordBaselineBody,
+		BlockRedirects:  []string{"/blocked"},
+	})
+
+	tests := []struct {
+		name     string
+		policy   DetectionPolicy
+		probe    *scanner.ProbeResult
+		baseline *scanner.ProbeResult
+		want     bool
+	}{
+		{"default status code", DefaultDetectionPolicy(), page(403, ""), page(200, "Welcome"), true},
+		{"server error", DefaultDetectionPolicy(), page(503, ""), page(200, "Welcome"), true},
+		{"server error on broken baseline", DefaultDetectionPolicy(), page(503, ""), page(500, ""), false},
+		{"keyword needs status change", noSimilarity, page(200, "Request blocked"), page(200, "Welcome"), false},
+		{"diverged from baseline", DefaultDetectionPolicy(), page(200, "Request blocked"), page(200, "Welcome"), true},
+		{"keyword with status change", DefaultDetectionPolicy(), page(400, "Request blocked"), page(200, "Welcome"), true},
+		{"custom status codes", DefaultDetectionPolicy().merge(DetectionPolicy{BlockStatusCodes: []int{418}}), page(403, ""), page(200, "Welcome"), false},
+		{"200 challenge page", challenge, page(200, "<h1>Please verify you are human</h1>"), page(200, "Welcome"), true},
+		{"keyword also in baseline", challenge, page(200, "Verify you are human"), page(200, "Verify you are human to log in"), false},
+		{"non-English keyword", challenge, page(200, "<title>Zugriff verweigert</title>"), page(200, "Willkommen"), true},
+		{"non-English keyword in CJK", challenge, page(200, "<h1>访问被拒绝</h1>"), page(200, "欢迎"), true},
+		{"block redirect", challenge, redirect("https://example.com/blocked?id=1"), page(200, "Welcome"), true},
+		{"followed block redirect", challenge, &scanner.ProbeResult{StatusCode: 200, URL: "https://example.com/blocked"}, page(200, "Welcome"), true},
+		{"redirect shared with baseline", challenge, redirect("/blocked"), redirect("/blocked"), false},
+		{"other redirect", challenge, redirect("/login"), page(200, "Welcome"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Blocked(tt.probe, tt.baseline); got != tt.want {
+				t.Errorf("Blocked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectionPolicyMerged(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "10-detection.yml")
+	second := filepath.Join(dir, "20-detection.yml")
+	if err := os.WriteFile(first, []byte(`
+probes:
+  - name: traversal
+    path: /?file=../../etc/passwd
+detection:
+  probes: [sqli, xss, traversal]
+  min_blocked_probes: 1
+  keywords: [blocked]
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte(`
+detection:
+  keywords: [verify you are human]
+  keyword_baseline: body
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := LoadMergedSignatureSet(dir)
+	if err != nil {
+		t.Fatalf("LoadMergedSignatureSet() error = %v", err)
+	}
+	got := set.Detection
+	if strings.Join(got.Probes, ",") != "sqli,xss,traversal" || got.MinBlockedProbes != 1 {
+		t.Errorf("probes = %v, min = %d; want the first file's", got.Probes, got.MinBlockedProbes)
+	}
+	if len(got.Keywords) != 1 || got.Keywords[0] != "verify you are human" || got.KeywordBaseline != KeywordBaselineBody {
+		t.Errorf("keywords = %v (%s), want the second file's", got.Keywords, got.KeywordBaseline)
+	}
+	if len(got.BlockStatusCodes) != 4 {
+		t.Errorf("block status codes = %v, want the defaults", got.BlockStatusCodes)
+	}
+	if len(set.Signatures) != len(GetAllSignatures()) {
+		t.Errorf("a detection-only file should keep the embedded signatures, got %d", len(set.Signatures))
+	}
+}
+
+func TestDetectionPolicyValidated(t *testing.T) {
+	tests := []struct {
+		name      string
+		detection string
+		want      string
+	}{
+		{"baseline probe", `{probes: [normal, sqli]}`, "cannot include the normal baseline probe"},
+		{"unknown probe", `{probes: [sqli, graphql]}`, `unknown detection probe "graphql"`},
+		{"unreachable minimum", `{probes: [sqli], min_blocked_probes: 2}`, "min_blocked_probes 2 is unreachable with 1 detection probes"},
+		{"unreachable default probes", `{min_blocked_probes: 4}`, "min_blocked_probes 4 is unreachable with 3 detection probes"},
+		{"status code", `{block_status_codes: [4030]}`, "invalid block status code 4030"},
+		{"empty keyword", `{keywords: ["  "]}`, "empty block keyword"},
+		{"keyword baseline", `{keyword_baseline: headers}`, `unknown keyword_baseline "headers"`},
+		{"similarity", `{min_similarity: 1.5}`, "min_similarity 1.5 is outside 0..1"},
+		{"baseline samples", `{baseline_samples: 11}`, "baseline_samples must be between 0 and 10, got 11"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte("detection: " + tt.detection + "\nsignatures: []\n")
+			if _, err := parseSignatureSetFromBytes(data); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
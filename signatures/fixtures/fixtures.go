@@ -0,0 +1,304 @@
+// Package fixtures checks signatures against recorded probe responses so
+// signature edits can be verified offline.
+//
+// A fixture file holds the responses a target gave to each probe and the
+// signatures they must match:
+//
+//	name: Cloudflare block page
+//	expect:
+//	  - signature: Cloudflare
+//	    min_confidence: 0.9
+//	probes:
+//	  normal:
+//	    status: 200
+//	    headers:
+//	      Server: cloudflare
+//	    tls:
+//	      san: [sni.cloudflaressl.com]
+//	  sqli:
+//	    status: 403
+//	    body: "Attention Required! | Cloudflare"
+//
+// Any signature that is not expected must stay below the detector's
+// reporting threshold.
+package fixtures
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ahmedtouahria/waf-detector/detector"
+	"github.com/ahmedtouahria/waf-detector/scanner"
+	"github.com/ahmedtouahria/waf-detector/signatures"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed data/*.yml
+var embedded embed.FS
+
+// Fixture is a recorded set of probe responses and the signatures they
+// should match
+type Fixture struct {
+	Name        string              `yaml:"name"`
+	Description string              `yaml:"description,omitempty"`
+	Expect      []Expectation       `yaml:"expect"`
+	Probes      map[string]Response `yaml:"probes"`
+
+	// Path is the file the fixture was loaded from
+	Path string `yaml:"-"`
+}
+
+// Expectation is a signature a fixture must match. MinConfidence defaults to
+// the detector's reporting threshold.
+type Expectation struct {
+	Signature     string  `yaml:"signature"`
+	MinConfidence float64 `yaml:"min_confidence,omitempty"`
+}
+
+// Response is a recorded response to one probe
+type Response struct {
+	Status  int               `yaml:"status"`
+	Headers map[string]Values `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty"`
+	// TLS describes the connection the response arrived on; a response
+	// without it came over plain HTTP
+	TLS *TLS `yaml:"tls,omitempty"`
+}
+
+// TLS is a recorded TLS connection, as matched by tls indicators
+type TLS struct {
+	Version string   `yaml:"version,omitempty"`
+	Cipher  string   `yaml:"cipher,omitempty"`
+	ALPN    string   `yaml:"alpn,omitempty"`
+	Issuer  string   `yaml:"issuer,omitempty"`
+	Subject string   `yaml:"subject,omitempty"`
+	SAN     []string `yaml:"san,omitempty"`
+}
+
+// Values holds the values of a header. In YAML it is a single string or a
+// list, e.g. for several Set-Cookie headers.
+type Values []string
+
+// UnmarshalYAML accepts a scalar or a sequence of strings
+func (v *Values) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*v = Values{value.Value}
+		return nil
+	}
+
+	var values []string
+	if err := value.Decode(&values); err != nil {
+		return fmt.Errorf("header must be a string or a list of strings: %w", err)
+	}
+	*v = values
+	return nil
+}
+
+// Parse parses and validates a fixture file
+func Parse(data []byte) (*Fixture, error) {
+	var f Fixture
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture: %w", err)
+	}
+
+	if f.Name == "" {
+		return nil, fmt.Errorf("fixture has no name")
+	}
+	if _, ok := f.Probes[string(scanner.ProbeNormal)]; !ok {
+		return nil, fmt.Errorf("fixture %q has no normal probe response", f.Name)
+	}
+	for probe, response := range f.Probes {
+		if response.Status < 100 || response.Status > 599 {
+			return nil, fmt.Errorf("fixture %q probe %s: invalid status %d", f.Name, probe, response.Status)
+		}
+	}
+	for _, e := range f.Expect {
+		if e.Signature == "" {
+			return nil, fmt.Errorf("fixture %q: expectation without a signature", f.Name)
+		}
+		if e.MinConfidence < 0 || e.MinConfidence > 1 {
+			return nil, fmt.Errorf("fixture %q: min_confidence for %s must be between 0 and 1", f.Name, e.Signature)
+		}
+	}
+	return &f, nil
+}
+
+// Load reads the fixtures at path, which is a fixture file or a directory of
+// .yml and .yaml files
+func Load(path string) ([]Fixture, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+	if !info.IsDir() {
+		return loadFiles(os.DirFS(filepath.Dir(path)), []string{filepath.Base(path)}, filepath.Dir(path))
+	}
+
+	fsys := os.DirFS(path)
+	names, err := fixtureFiles(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	return loadFiles(fsys, names, path)
+}
+
+// Embedded returns the fixtures shipped for the embedded signatures
+func Embedded() ([]Fixture, error) {
+	names, err := fixtureFiles(embedded, "data")
+	if err != nil {
+		return nil, err
+	}
+	return loadFiles(embedded, names, "")
+}
+
+func fixtureFiles(fsys fs.FS, dir string) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if !entry.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			names = append(names, path.Join(dir, entry.Name()))
+		}
+	}
+	return names, nil
+}
+
+// loadFiles parses the named files of fsys, recording their path under root
+func loadFiles(fsys fs.FS, names []string, root string) ([]Fixture, error) {
+	fixtures := make([]Fixture, 0, len(names))
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture: %w", err)
+		}
+
+		f, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		f.Path = filepath.Join(root, filepath.FromSlash(name))
+		fixtures = append(fixtures, *f)
+	}
+	return fixtures, nil
+}
+
+// ProbeResults returns the recorded responses as scan results
+func (f *Fixture) ProbeResults() map[scanner.ProbeType]*scanner.ProbeResult {
+	probes := make(map[scanner.ProbeType]*scanner.ProbeResult, len(f.Probes))
+	for name, response := range f.Probes {
+		headers := make(http.Header)
+		for key, values := range response.Headers {
+			for _, value := range values {
+				headers.Add(key, value)
+			}
+		}
+
+		result := &scanner.ProbeResult{
+			Type:       scanner.ProbeType(name),
+			StatusCode: response.Status,
+			Headers:    headers,
+			Body:       response.Body,
+			BodyLength: len(response.Body),
+		}
+		if tls := response.TLS; tls != nil {
+			result.TLS = &scanner.TLSInfo{
+				Version:     tls.Version,
+				CipherSuite: tls.Cipher,
+				ALPN:        tls.ALPN,
+				Issuer:      tls.Issuer,
+				Subject:     tls.Subject,
+				SANs:        tls.SAN,
+			}
+		}
+		probes[scanner.ProbeType(name)] = result
+	}
+	return probes
+}
+
+// Check matches every signature against the fixture and returns a message
+// for each expected signature that is missing or too weak, and for each
+// other signature that reaches the reporting threshold
+func Check(sigs []signatures.Signature, f Fixture) []string {
+	probes := f.ProbeResults()
+
+	matches := make(map[string]signatures.MatchResult, len(sigs))
+	for _, sig := range sigs {
+		matches[sig.Name()] = sig.Match(probes)
+	}
+
+	var problems []string
+	expected := make(map[string]bool, len(f.Expect))
+	for _, e := range f.Expect {
+		expected[e.Signature] = true
+
+		match, ok := matches[e.Signature]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("signature %q does not exist", e.Signature))
+			continue
+		}
+
+		minConfidence := e.MinConfidence
+		if minConfidence == 0 {
+			minConfidence = detector.DefaultMinConfidence
+		}
+		if match.Confidence < minConfidence {
+			problems = append(problems, fmt.Sprintf("%s matched at %.2f, want at least %.2f%s",
+				e.Signature, match.Confidence, minConfidence, describe(match)))
+		}
+	}
+
+	for _, sig := range sigs {
+		match := matches[sig.Name()]
+		if !expected[sig.Name()] && match.Confidence >= detector.DefaultMinConfidence {
+			problems = append(problems, fmt.Sprintf("unexpected match %s at %.2f%s",
+				sig.Name(), match.Confidence, describe(match)))
+		}
+	}
+
+	return problems
+}
+
+// describe lists the evidence of a match for failure messages
+func describe(match signatures.MatchResult) string {
+	if len(match.Evidence) == 0 {
+		return ""
+	}
+	parts := make([]string, len(match.Evidence))
+	for i, e := range match.Evidence {
+		parts[i] = e.String()
+	}
+	return ": " + strings.Join(parts, "; ")
+}
+
+// Uncovered returns the names of signatures that no fixture expects, sorted
+func Uncovered(sigs []signatures.Signature, fixtures []Fixture) []string {
+	covered := make(map[string]bool)
+	for _, f := range fixtures {
+		for _, e := range f.Expect {
+			covered[e.Signature] = true
+		}
+	}
+
+	var names []string
+	for _, sig := range sigs {
+		if !covered[sig.Name()] {
+			names = append(names, sig.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
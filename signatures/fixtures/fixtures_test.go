@@ -0,0 +1,177 @@
+package fixtures
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ahmedtouahria/waf-detector/signatures"
+)
+
+func TestEmbeddedCoverage(t *testing.T) {
+	all, err := Embedded()
+	if err != nil {
+		t.Fatalf("Embedded() error = %v", err)
+	}
+	if uncovered := Uncovered(signatures.GetAllSignatures(), all); len(uncovered) > 0 {
+		t.Errorf("signatures without a fixture: %s", strings.Join(uncovered, ", "))
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signatures.yml")
+	if err := os.WriteFile(path, []byte(`
+signatures:
+  - name: Example
+    enabled: true
+    indicators:
+      - type: header
+        key: Server
+        value: example-waf
+        condition: contains
+        confidence: 0.6
+  - name: Other
+    enabled: true
+    indicators:
+      - type: body
+        value: blocked
+        condition: contains
+        confidence: 0.5
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := signatures.LoadSignatureSetFromYAML(path)
+	if err != nil {
+		t.Fatalf("LoadSignatureSetFromYAML() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		fixture string
+		want    []string
+	}{
+		{
+			name: "clean",
+			fixture: `
+name: example
+expect:
+  - signature: Example
+probes:
+  normal:
+    status: 200
+    headers:
+      Server: example-waf
+`,
+		},
+		{
+			name: "too weak",
+			fixture: `
+name: example
+expect:
+  - signature: Example
+    min_confidence: 0.9
+probes:
+  normal:
+    status: 200
+    headers:
+      Server: example-waf
+`,
+			want: []string{"Example matched at 0.60, want at least 0.90: "},
+		},
+		{
+			name: "unexpected match",
+			fixture: `
+name: example
+expect:
+  - signature: Example
+probes:
+  normal:
+    status: 200
+    headers:
+      Server: example-waf
+    body: request blocked
+`,
+			want: []string{"unexpected match Other at 0.50: "},
+		},
+		{
+			name: "unknown signature",
+			fixture: `
+name: example
+expect:
+  - signature: Missing
+probes:
+  normal:
+    status: 200
+`,
+			want: []string{`signature "Missing" does not exist`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse([]byte(tt.fixture))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			problems := Check(set.Signatures, *f)
+			if len(problems) != len(tt.want) {
+				t.Fatalf("Check() = %q, want %d problems", problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(problems[i], want) {
+					t.Errorf("Check()[%d] = %q, want prefix %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		wantErr string
+	}{
+		{
+			name:    "no name",
+			fixture: "probes:\n  normal:\n    status: 200\n",
+			wantErr: "no name",
+		},
+		{
+			name:    "no normal probe",
+			fixture: "name: x\nprobes:\n  sqli:\n    status: 403\n",
+			wantErr: "no normal probe",
+		},
+		{
+			name:    "invalid status",
+			fixture: "name: x\nprobes:\n  normal:\n    status: 20\n",
+			wantErr: "invalid status 20",
+		},
+		{
+			name:    "unknown field",
+			fixture: "name: x\nprobes:\n  normal:\n    status: 200\n    header: {}\n",
+			wantErr: "not found",
+		},
+		{
+			name:    "header list",
+			fixture: "name: x\nprobes:\n  normal:\n    status: 200\n    headers:\n      Set-Cookie: [a=1, b=2]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.fixture))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Parse() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+// Package fixturestest runs signature fixtures from Go tests.
+package fixturestest
+
+import (
+	"testing"
+
+	"github.com/ahmedtouahria/waf-detector/signatures"
+	"github.com/ahmedtouahria/waf-detector/signatures/fixtures"
+)
+
+// Run checks every fixture against sigs in its own subtest. Use it to test
+// custom signature files alongside their fixtures:
+//
+//	set, err := signatures.LoadSignatureSetFromYAML("my-signatures.yml")
+//	...
+//	all, err := fixtures.Load("testdata/fixtures")
+//	...
+//	fixturestest.Run(t, set.Signatures, all)
+func Run(t *testing.T, sigs []signatures.Signature, all []fixtures.Fixture) {
+	t.Helper()
+	for _, f := range all {
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			for _, problem := range fixtures.Check(sigs, f) {
+				t.Errorf("%s: %s", f.Path, problem)
+			}
+		})
+	}
+}
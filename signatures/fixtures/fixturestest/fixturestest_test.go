@@ -0,0 +1,16 @@
+package fixturestest
+
+import (
+	"testing"
+
+	"github.com/ahmedtouahria/waf-detector/signatures"
+	"github.com/ahmedtouahria/waf-detector/signatures/fixtures"
+)
+
+func TestEmbedded(t *testing.T) {
+	all, err := fixtures.Embedded()
+	if err != nil {
+		t.Fatalf("Embedded() error = %v", err)
+	}
+	Run(t, signatures.GetAllSignatures(), all)
+}
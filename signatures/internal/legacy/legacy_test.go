@@ -0,0 +1,84 @@
+package legacy
+
+import (
+	"testing"
+
+	"github.com/ahmedtouahria/waf-detector/detector"
+	"github.com/ahmedtouahria/waf-detector/signatures"
+	"github.com/ahmedtouahria/waf-detector/signatures/fixtures"
+)
+
+// renamed maps legacy signature names to the YAML signature that replaces them
+var renamed = map[string]string{
+	"Amazon CloudFront": "AWS WAF",
+	"StackPath WAF":     "StackPath",
+	"EdgeCast WAF":      "Verizon Digital Media",
+	"SiteGround WAF":    "SiteGround",
+}
+
+// accepted lists known differences, keyed by fixture and legacy signature
+// name, with the reason the YAML behaviour is preferred
+var accepted = map[string]string{
+	"Citrix NetScaler load-balanced site/Citrix NetScaler": "legacy code only read the first Set-Cookie header and missed ns_af",
+	"StackPath Server header only/StackPath WAF":           "legacy code counted an indicator once per probe, so one header repeated on four responses passed minimum_indicators",
+	"Azure Front Door WAF block/Azure WAF":                 "legacy code counted X-Azure-Ref once per probe; the header alone is shared by every Azure edge service",
+	"Edgecast WAF custom error/EdgeCast WAF":               "legacy code only knew the ECD server and X-EC-Debug, not ECAcc or X-EC-Custom-Error",
+}
+
+// TestParity reports every fixture where a legacy signature and its YAML
+// replacement disagree about whether the WAF is detected
+func TestParity(t *testing.T) {
+	// The embedded fixtures plus cases that only exist to show where the
+	// legacy signatures behaved differently
+	all, err := fixtures.Embedded()
+	if err != nil {
+		t.Fatalf("Embedded() error = %v", err)
+	}
+	extra, err := fixtures.Load("testdata")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	all = append(all, extra...)
+
+	current := make(map[string]signatures.Signature)
+	for _, sig := range signatures.GetAllSignatures() {
+		current[sig.Name()] = sig
+	}
+
+	seen := make(map[string]bool)
+	for _, old := range Signatures() {
+		name := old.Name()
+		if renamed[name] != "" {
+			name = renamed[name]
+		}
+		sig, ok := current[name]
+		if !ok {
+			t.Errorf("legacy signature %q has no YAML replacement", old.Name())
+			continue
+		}
+
+		for _, f := range all {
+			probes := f.ProbeResults()
+			before := old.Match(probes).Confidence
+			after := sig.Match(probes).Confidence
+			if (before >= detector.DefaultMinConfidence) == (after >= detector.DefaultMinConfidence) {
+				continue
+			}
+
+			key := f.Name + "/" + old.Name()
+			seen[key] = true
+			if reason, ok := accepted[key]; ok {
+				t.Logf("%s: accepted: %s", key, reason)
+				continue
+			}
+			t.Errorf("%s (%s): legacy %s scores %.2f, YAML %s scores %.2f",
+				f.Name, f.Path, old.Name(), before, sig.Name(), after)
+		}
+	}
+
+	for key := range accepted {
+		if !seen[key] {
+			t.Errorf("accepted difference %q no longer occurs; remove it", key)
+		}
+	}
+}
@@ -0,0 +1,508 @@
+package signatures
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ahmedtouahria/waf-detector/scanner"
+	"gopkg.in/yaml.v3"
+)
+
+// Severity ranks a lint diagnostic
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem found in a signatures file. Line and Column are
+// 1-based; Column is 0 when only the line is known.
+type Diagnostic struct {
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// String formats the diagnostic as "line:column: severity: message"
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+var (
+	signaturesConfigFields = yamlFields(reflect.TypeOf(SignaturesConfig{}))
+	signatureFields        = yamlFields(reflect.TypeOf(YAMLSignature{}))
+	indicatorFields        = yamlFields(reflect.TypeOf(Indicator{}))
+	probeFields            = yamlFields(reflect.TypeOf(scanner.ProbeDefinition{}))
+	detectionFields        = yamlFields(reflect.TypeOf(DetectionPolicy{}))
+
+	yamlLinePrefix = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+)
+
+// LintFile checks a signatures file, see Lint
+func LintFile(path string) ([]Diagnostic, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signatures file: %w", err)
+	}
+	return Lint(data), nil
+}
+
+// Lint checks signatures YAML against the schema the loader expects and
+// returns diagnostics ordered by position. Errors are problems that make the
+// file fail to load or an indicator never match; warnings flag likely
+// mistakes such as disabled signatures.
+func Lint(data []byte) []Diagnostic {
+	l := &linter{knownProbes: make(map[string]bool)}
+	for _, probeType := range scanner.BuiltinProbeTypes() {
+		l.knownProbes[string(probeType)] = true
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		line := 0
+		message := strings.TrimPrefix(err.Error(), "yaml: ")
+		if m := yamlLinePrefix.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			message = err.Error()[len(m[0]):]
+		}
+		return []Diagnostic{{Line: line, Severity: SeverityError, Message: message}}
+	}
+	if len(doc.Content) == 0 {
+		return []Diagnostic{{Line: 1, Column: 1, Severity: SeverityError, Message: "file is empty"}}
+	}
+
+	l.file(doc.Content[0])
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i], l.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.diagnostics
+}
+
+// HasErrors reports whether any diagnostic is an error
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+type linter struct {
+	diagnostics []Diagnostic
+	knownProbes map[string]bool
+}
+
+func (l *linter) report(node *yaml.Node, severity Severity, format string, args ...interface{}) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		Line:     node.Line,
+		Column:   node.Column,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) errorf(node *yaml.Node, format string, args ...interface{}) {
+	l.report(node, SeverityError, format, args...)
+}
+
+func (l *linter) warnf(node *yaml.Node, format string, args ...interface{}) {
+	l.report(node, SeverityWarning, format, args...)
+}
+
+// errors returns the number of errors reported so far
+func (l *linter) errors() int {
+	n := 0
+	for _, d := range l.diagnostics {
+		if d.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+// mapping returns the values of a mapping node by key and reports keys that
+// are not part of the schema
+func (l *linter) mapping(node *yaml.Node, what string, known map[string]bool) map[string]*yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		l.errorf(node, "%s must be a mapping", what)
+		return nil
+	}
+
+	values := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if !known[key.Value] {
+			if suggestion := closest(key.Value, known); suggestion != "" {
+				l.errorf(key, "unknown %s field %q (did you mean %q?)", what, key.Value, suggestion)
+			} else {
+				l.errorf(key, "unknown %s field %q", what, key.Value)
+			}
+			continue
+		}
+		values[key.Value] = value
+	}
+	return values
+}
+
+// sequence returns the items of a sequence node
+func (l *linter) sequence(node *yaml.Node, what string) []*yaml.Node {
+	if node.Kind != yaml.SequenceNode {
+		l.errorf(node, "%s must be a list", what)
+		return nil
+	}
+	return node.Content
+}
+
+// decode decodes node into v, reporting type errors at the node
+func (l *linter) decode(node *yaml.Node, v interface{}) bool {
+	err := node.Decode(v)
+	if err == nil {
+		return true
+	}
+
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for _, message := range typeErr.Errors {
+			l.errorf(node, "%s", yamlLinePrefix.ReplaceAllString(message, ""))
+		}
+		return false
+	}
+	l.errorf(node, "%s", err)
+	return false
+}
+
+func (l *linter) file(root *yaml.Node) {
+	fields := l.mapping(root, "signatures file", signaturesConfigFields)
+	if fields == nil {
+		return
+	}
+
+	if probes := fields["probes"]; probes != nil {
+		for _, node := range l.sequence(probes, "probes") {
+			l.probe(node)
+		}
+	}
+
+	// Checked after the probes so that custom detection probes are known
+	if detection := fields["detection"]; detection != nil {
+		l.detection(detection)
+	}
+
+	// A file that only sets probes or a detection policy overlays the
+	// embedded signatures
+	sigs := fields["signatures"]
+	if sigs == nil {
+		if fields["probes"] == nil && fields["detection"] == nil {
+			l.errorf(root, "no signatures defined")
+		}
+		return
+	}
+
+	names := make(map[string]int)
+	for _, node := range l.sequence(sigs, "signatures") {
+		l.signature(node, names)
+	}
+}
+
+func (l *linter) probe(node *yaml.Node) {
+	if l.mapping(node, "probe", probeFields) == nil {
+		return
+	}
+
+	var probe scanner.ProbeDefinition
+	if !l.decode(node, &probe) {
+		return
+	}
+	if err := probe.Validate(); err != nil {
+		l.errorf(node, "%s", err)
+		return
+	}
+	if l.knownProbes[probe.Name] {
+		l.errorf(node, "duplicate probe %q", probe.Name)
+		return
+	}
+	l.knownProbes[probe.Name] = true
+}
+
+func (l *linter) detection(node *yaml.Node) {
+	if l.mapping(node, "detection", detectionFields) == nil {
+		return
+	}
+
+	var policy DetectionPolicy
+	if !l.decode(node, &policy) {
+		return
+	}
+	if err := policy.validate(l.knownProbes); err != nil {
+		l.errorf(node, "%s", err)
+	}
+}
+
+// signature checks a signature; names maps the lower-cased names seen so
+// far to their line
+func (l *linter) signature(node *yaml.Node, names map[string]int) {
+	fields := l.mapping(node, "signature", signatureFields)
+	if fields == nil {
+		return
+	}
+
+	var sig YAMLSignature
+	for key, value := range fields {
+		if key == "indicators" {
+			continue
+		}
+		var v interface{}
+		switch key {
+		case "name":
+			v = &sig.WAFName
+		case "enabled":
+			v = &sig.Enabled
+		case "minimum_indicators":
+			v = &sig.MinimumIndicators
+		case "confidence_multiplier":
+			v = &sig.ConfidenceMultiplier
+		case "category":
+			v = &sig.Category
+		case "challenge":
+			v = &sig.Challenge
+		default:
+			v = new(string)
+		}
+		l.decode(value, v)
+	}
+
+	if nameNode := fields["name"]; nameNode == nil || strings.TrimSpace(sig.WAFName) == "" {
+		l.errorf(node, "signature has no name")
+	} else {
+		key := strings.ToLower(strings.TrimSpace(sig.WAFName))
+		if line, ok := names[key]; ok {
+			l.errorf(nameNode, "duplicate signature name %q, first defined on line %d", sig.WAFName, line)
+		} else {
+			names[key] = nameNode.Line
+		}
+	}
+
+	// A disabled entry with no indicators only turns off a signature of the
+	// same name from an earlier file
+	enabled := fields["enabled"]
+	override := enabled != nil && !sig.Enabled && fields["indicators"] == nil
+	if override {
+		return
+	}
+	if enabled == nil {
+		l.warnf(node, "enabled is not set, so the signature is disabled")
+	} else if !sig.Enabled {
+		l.warnf(enabled, "signature is disabled (enabled: false)")
+	}
+
+	if sig.Category != "" && RoleForCategory(sig.Category) == "" {
+		l.warnf(fields["category"], "unknown category %q (use cdn, cloud, service, appliance, opensource, plugin or framework)", sig.Category)
+	}
+
+	if sig.Challenge != "" && !validChallengeType(sig.Challenge) {
+		l.errorf(fields["challenge"], "unknown challenge type %q (use javascript, captcha or meta_refresh)", sig.Challenge)
+	}
+
+	if multiplier := fields["confidence_multiplier"]; multiplier != nil && (sig.ConfidenceMultiplier < 0 || sig.ConfidenceMultiplier > 1) {
+		l.errorf(multiplier, "confidence_multiplier %v is outside 0..1", sig.ConfidenceMultiplier)
+	}
+
+	var indicators []*yaml.Node
+	if list := fields["indicators"]; list != nil {
+		indicators = l.sequence(list, "indicators")
+	}
+	if len(indicators) == 0 {
+		l.errorf(node, "signature has no indicators")
+	}
+	for _, indicator := range indicators {
+		l.indicator(indicator, true)
+	}
+
+	if minimum := fields["minimum_indicators"]; minimum != nil {
+		if sig.MinimumIndicators < 0 {
+			l.errorf(minimum, "minimum_indicators must not be negative")
+		} else if sig.MinimumIndicators > len(indicators) {
+			l.errorf(minimum, "minimum_indicators %d is unreachable with %d indicators", sig.MinimumIndicators, len(indicators))
+		}
+	}
+}
+
+// indicator checks an indicator and its group members. Top-level indicators
+// are also run through the loader's own validation once the schema checks
+// pass, which catches bad regexes, probes and cookie matches.
+func (l *linter) indicator(node *yaml.Node, topLevel bool) {
+	fields := l.mapping(node, "indicator", indicatorFields)
+	if fields == nil {
+		return
+	}
+
+	var ind Indicator
+	if !l.decode(node, &ind) {
+		return
+	}
+	before := l.errors()
+
+	if confidence := fields["confidence"]; confidence != nil {
+		switch {
+		case ind.Confidence < 0 || ind.Confidence > 1:
+			l.errorf(confidence, "confidence %v is outside 0..1", ind.Confidence)
+		case !topLevel:
+			l.warnf(confidence, "confidence of a group member is ignored")
+		}
+	} else if topLevel {
+		l.warnf(node, "indicator has no confidence and never contributes")
+	}
+
+	if kind, _ := ind.group(); kind != "" {
+		if fields["type"] != nil {
+			l.errorf(fields["type"], "group indicators cannot have a type")
+		}
+		for _, key := range []string{"all", "any", "not"} {
+			if fields[key] == nil {
+				continue
+			}
+			if key != string(kind) {
+				l.errorf(fields[key], "an indicator can only have one of all, any or not")
+				continue
+			}
+			for _, member := range l.sequence(fields[key], key) {
+				l.indicator(member, false)
+			}
+		}
+	} else {
+		l.indicatorType(node, fields, ind)
+	}
+
+	if topLevel && l.errors() == before {
+		if err := ind.prepare(l.knownProbes); err != nil {
+			l.errorf(node, "%s", err)
+		}
+	}
+}
+
+// indicatorType checks the type, key, condition and values of a plain
+// indicator
+func (l *linter) indicatorType(node *yaml.Node, fields map[string]*yaml.Node, ind Indicator) {
+	conditions := map[IndicatorType][]IndicatorCondition{
+		IndicatorHeader: {ConditionExists, ConditionContains, ConditionEquals, ConditionRegex},
+		IndicatorCookie: {ConditionExists, ConditionContains, ConditionEquals, ConditionRegex},
+		IndicatorBody:   {ConditionContains, ConditionRegex},
+		IndicatorTLS:    {ConditionExists, ConditionContains, ConditionEquals, ConditionRegex},
+	}
+
+	switch ind.Type {
+	case "":
+		l.errorf(node, "indicator needs a type, or all, any or not")
+		return
+	case IndicatorStatusCode:
+		if ind.Condition != "" && ind.Condition != ConditionRegex {
+			l.errorf(fields["condition"], "status_code indicators only support the regex condition")
+		} else if ind.Condition == "" && len(ind.StatusCodes) == 0 {
+			l.errorf(node, "status_code indicator needs status_codes or a regex condition")
+		}
+	case IndicatorHeader, IndicatorCookie, IndicatorBody, IndicatorTLS:
+		supported := conditions[ind.Type]
+		if ind.Condition == "" {
+			l.errorf(node, "%s indicator needs a condition", ind.Type)
+			return
+		}
+		if !containsCondition(supported, ind.Condition) {
+			names := make([]string, len(supported))
+			for i, c := range supported {
+				names[i] = string(c)
+			}
+			l.errorf(fields["condition"], "unknown condition %q for %s indicators (use %s)", ind.Condition, ind.Type, strings.Join(names, ", "))
+			return
+		}
+	default:
+		l.errorf(fields["type"], "unknown indicator type %q (use header, cookie, body, status_code or tls)", ind.Type)
+		return
+	}
+
+	if ind.Type == IndicatorHeader && ind.Key == "" {
+		l.errorf(node, "header indicators need a key")
+	}
+	if ind.Type == IndicatorHeader && ind.Match == "" && strings.HasSuffix(ind.Key, "-") {
+		l.warnf(fields["key"], "header key %q only matches a header with exactly that name; add match: prefix to match names starting with it", ind.Key)
+	}
+
+	noValue := ind.Value == "" && len(ind.Values) == 0
+	switch ind.Condition {
+	case ConditionContains, ConditionEquals:
+		// A cookie that merely has to contain something is an existence check
+		if noValue && ind.Type != IndicatorCookie {
+			l.errorf(node, "%s condition needs value or values", ind.Condition)
+		}
+	case ConditionExists:
+		if !noValue {
+			l.warnf(node, "value and values are ignored by the exists condition")
+		}
+	}
+}
+
+func containsCondition(conditions []IndicatorCondition, c IndicatorCondition) bool {
+	for _, condition := range conditions {
+		if condition == c {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlFields lists the YAML keys of a struct type
+func yamlFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// closest returns the known field nearest to name by edit distance, or ""
+// when none is close enough to be a likely typo
+func closest(name string, known map[string]bool) string {
+	best, bestDistance := "", 3
+	for field := range known {
+		if d := editDistance(name, field); d < bestDistance || (d == bestDistance && best != "" && field < best) {
+			best, bestDistance = field, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,206 @@
+package signatures
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	// Each case is a single signature with one problem
+	tests := []struct {
+		name      string
+		signature string
+		want      string
+	}{
+		{"unknown type", `
+  - name: A
+    enabled: true
+    indicators:
+      - type: headers
+        key: Server
+        condition: exists
+        confidence: 0.3`, `7:15: error: unknown indicator type "headers"`},
+		{"unknown condition", `
+  - name: A
+    enabled: true
+    indicators:
+      - type: body
+        condition: exists
+        confidence: 0.3`, `8:20: error: unknown condition "exists" for body indicators`},
+		{"missing key", `
+  - name: A
+    enabled: true
+    indicators:
+      - type: header
+        condition: exists
+        confidence: 0.3`, "7:9: error: header indicators need a key"},
+		{"unknown tls key", `
+  - name: A
+    enabled: true
+    indicators:
+      - type: tls
+        key: issuer_cn
+        condition: exists
+        confidence: 0.3`, `7:9: error: unknown tls key "issuer_cn"`},
+		{"confidence range", `
+  - name: A
+    enabled: true
+    indicators:
+      - type: status_code
+        status_codes: [403]
+        confidence: 1.5`, "9:21: error: confidence 1.5 is outside 0..1"},
+		{"unreachable minimum", `
+  - name: A
+    enabled: true
+    minimum_indicators: 2
+    indicators:
+      - type: status_code
+        status_codes: [403]
+        confidence: 0.3`, "6:25: error: minimum_indicators 2 is unreachable with 1 indicators"},
+		{"bad regex", `
+  - name: A
+    enabled: true
+    indicators:
+      - type: body
+        condition: regex
+        value: "(unclosed"
+        confidence: 0.3`, `7:9: error: invalid regex "(unclosed"`},
+		{"typo in field", `
+  - name: A
+    enabled: true
+    indicators:
+      - type: header
+        key: Server
+        condition: exists
+        confidance: 0.3`, `10:9: error: unknown indicator field "confidance" (did you mean "confidence"?)`},
+		{"wrong type", `
+  - name: A
+    enabled: yes please
+    indicators:
+      - type: status_code
+        status_codes: [403]
+        confidence: 0.3`, "5:14: error: cannot unmarshal !!str `yes please` into bool"},
+		{"disabled", `
+  - name: A
+    enabled: false
+    indicators:
+      - type: status_code
+        status_codes: [403]
+        confidence: 0.3`, "5:14: warning: signature is disabled (enabled: false)"},
+		{"prefix-like header key", `
+  - name: A
+    enabled: true
+    indicators:
+      - type: header
+        key: X-Barracuda-
+        condition: exists
+        confidence: 0.3`, `8:14: warning: header key "X-Barracuda-" only matches a header with exactly that name`},
+		{"unknown challenge type", `
+  - name: A
+    enabled: true
+    challenge: recaptcha
+    indicators:
+      - type: status_code
+        status_codes: [403]
+        confidence: 0.3`, `6:16: error: unknown challenge type "recaptcha" (use javascript, captcha or meta_refresh)`},
+		{"member confidence", `
+  - name: A
+    enabled: true
+    indicators:
+      - any:
+          - type: status_code
+            status_codes: [403]
+            confidence: 0.3
+        confidence: 0.3`, "10:25: warning: confidence of a group member is ignored"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte("version: \"1.0\"\n\nsignatures:" + tt.signature + "\n")
+			diags := Lint(data)
+			for _, d := range diags {
+				if strings.HasPrefix(d.String(), tt.want) {
+					return
+				}
+			}
+			t.Errorf("Lint() = %v, want %q", diags, tt.want)
+		})
+	}
+}
+
+func TestLintDuplicateNames(t *testing.T) {
+	data := []byte(`signatures:
+  - name: Cloudflare
+    enabled: true
+    indicators: [{type: status_code, status_codes: [403], confidence: 0.3}]
+  - name: cloudflare
+    enabled: true
+    indicators: [{type: status_code, status_codes: [403], confidence: 0.3}]
+`)
+
+	diags := Lint(data)
+	if len(diags) != 1 || diags[0].String() != `5:11: error: duplicate signature name "cloudflare", first defined on line 2` {
+		t.Errorf("Lint() = %v", diags)
+	}
+	if !HasErrors(diags) {
+		t.Error("HasErrors() = false")
+	}
+}
+
+func TestLintSyntaxError(t *testing.T) {
+	diags := Lint([]byte("signatures:\n  - name: A\n    enabled: true\n    indicators: [\n"))
+	if len(diags) != 1 || diags[0].Line == 0 || diags[0].Severity != SeverityError {
+		t.Errorf("Lint() = %v, want a located syntax error", diags)
+	}
+}
+
+func TestLintDisableOverride(t *testing.T) {
+	data := []byte(`signatures:
+  - name: Cloudflare
+    enabled: false
+`)
+	if diags := Lint(data); len(diags) != 0 {
+		t.Errorf("Lint() = %v, want no diagnostics for a disable-only entry", diags)
+	}
+}
+
+func TestLintEmbeddedSignatures(t *testing.T) {
+	data, err := embeddedSignatures.ReadFile("waf-signatures.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range Lint(data) {
+		t.Errorf("waf-signatures.yml:%s", d)
+	}
+}
+
+func TestLintDetection(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"detection only", "detection:\n  keyword_baseline: body\n", ""},
+		{"typo in field", "detection:\n  keyword: [blocked]\n", `2:3: error: unknown detection field "keyword" (did you mean "keywords"?)`},
+		{"unknown probe", "detection:\n  probes: [sqli, graphql]\n", `2:3: error: unknown detection probe "graphql"`},
+		{"custom probe", "probes:\n  - name: graphql\n    path: /graphql\ndetection:\n  probes: [sqli, graphql]\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := Lint([]byte(tt.data))
+			if tt.want == "" {
+				if len(diags) != 0 {
+					t.Errorf("Lint() = %v, want no diagnostics", diags)
+				}
+				return
+			}
+			for _, d := range diags {
+				if strings.HasPrefix(d.String(), tt.want) {
+					return
+				}
+			}
+			t.Errorf("Lint() = %v, want %q", diags, tt.want)
+		})
+	}
+}
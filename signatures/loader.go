@@ -3,6 +3,10 @@ package signatures
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/ahmedtouahria/waf-detector/scanner"
@@ -17,6 +21,13 @@ const (
 	IndicatorCookie     IndicatorType = "cookie"
 	IndicatorBody       IndicatorType = "body"
 	IndicatorStatusCode IndicatorType = "status_code"
+	IndicatorTLS        IndicatorType = "tls"
+
+	// Group indicators combine nested indicators; they are written as
+	// all:, any: or not: keys rather than a type
+	IndicatorAll IndicatorType = "all"
+	IndicatorAny IndicatorType = "any"
+	IndicatorNot IndicatorType = "not"
 )
 
 // IndicatorCondition defines how to match the indicator
@@ -29,6 +40,56 @@ const (
 	ConditionRegex    IndicatorCondition = "regex"
 )
 
+// KeyMatch defines how the key of a header or cookie indicator selects names.
+// Header keys match exactly by default and cookie keys by prefix.
+type KeyMatch string
+
+const (
+	KeyMatchPrefix KeyMatch = "prefix"
+	KeyMatchExact  KeyMatch = "exact"
+	KeyMatchRegex  KeyMatch = "regex"
+)
+
+// Differential defines how an indicator compares a probe with the baseline
+type Differential string
+
+const (
+	DifferentialAppears    Differential = "appears"
+	DifferentialDisappears Differential = "disappears"
+)
+
+// ProbeList names the probes an indicator applies to. In YAML it is either a
+// single probe name or a list of names.
+type ProbeList []string
+
+// UnmarshalYAML accepts a scalar or a sequence of probe names
+func (p *ProbeList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*p = ProbeList{value.Value}
+		return nil
+	}
+
+	var names []string
+	if err := value.Decode(&names); err != nil {
+		return fmt.Errorf("probe must be a name or a list of names: %w", err)
+	}
+	*p = names
+	return nil
+}
+
+// allows reports whether the list admits a probe; an empty list admits all
+func (p ProbeList) allows(probeType scanner.ProbeType) bool {
+	if len(p) == 0 {
+		return true
+	}
+	for _, name := range p {
+		if name == string(probeType) {
+			return true
+		}
+	}
+	return false
+}
+
 // Indicator represents a single detection pattern
 type Indicator struct {
 	Type             IndicatorType      `yaml:"type"`
@@ -40,6 +101,32 @@ type Indicator struct {
 	CaseInsensitive  bool               `yaml:"case_insensitive,omitempty"`
 	Confidence       float64            `yaml:"confidence"`
 	RequireAllValues bool               `yaml:"require_all_values,omitempty"`
+	Probe            ProbeList          `yaml:"probe,omitempty"`
+
+	// Differential compares the probes the indicator applies to with the
+	// Baseline probe (default normal): "appears" matches when the indicator
+	// fires on the probe but not on the baseline, "disappears" when it fires
+	// on the baseline but not on the probe
+	Differential Differential `yaml:"differential,omitempty"`
+	Baseline     string       `yaml:"baseline,omitempty"`
+
+	// Match selects header or cookie names by exact name, prefix or regex.
+	// Attribute applies a cookie indicator's condition to a cookie attribute
+	// such as Domain instead of the value.
+	Match     KeyMatch `yaml:"match,omitempty"`
+	Attribute string   `yaml:"attribute,omitempty"`
+
+	// All, Any and Not make the indicator a group that matches when all, any
+	// or none of the nested indicators match. Only the group's confidence
+	// counts; a probe set on the group applies to members without one.
+	All []Indicator `yaml:"all,omitempty"`
+	Any []Indicator `yaml:"any,omitempty"`
+	Not []Indicator `yaml:"not,omitempty"`
+
+	// patterns holds the compiled expressions for regex indicators
+	patterns []*regexp.Regexp
+	// keyPattern holds the compiled key of regex header and cookie matches
+	keyPattern *regexp.Regexp
 }
 
 // YAMLSignature represents a WAF signature loaded from YAML
@@ -52,12 +139,26 @@ type YAMLSignature struct {
 	Description          string      `yaml:"description,omitempty"`
 	Vendor               string      `yaml:"vendor,omitempty"`
 	Category             string      `yaml:"category,omitempty"`
+
+	// Challenge marks a signature that recognises a challenge page of this
+	// type; it is reported as the target's challenge instead of a layer
+	Challenge ChallengeType `yaml:"challenge,omitempty"`
 }
 
 // SignaturesConfig represents the full YAML configuration
 type SignaturesConfig struct {
-	Version    string          `yaml:"version"`
-	Signatures []YAMLSignature `yaml:"signatures"`
+	Version    string                    `yaml:"version"`
+	Probes     []scanner.ProbeDefinition `yaml:"probes,omitempty"`
+	Detection  DetectionPolicy           `yaml:"detection,omitempty"`
+	Signatures []YAMLSignature           `yaml:"signatures"`
+}
+
+// SignatureSet holds the enabled signatures, custom probes and detection
+// policy of a signatures file
+type SignatureSet struct {
+	Signatures []Signature
+	Probes     []scanner.ProbeDefinition
+	Detection  DetectionPolicy
 }
 
 // Name returns the signature name
@@ -65,104 +166,424 @@ func (y *YAMLSignature) Name() string {
 	return y.WAFName
 }
 
+// Metadata implements the Describer interface
+func (y *YAMLSignature) Metadata() Metadata {
+	return Metadata{
+		Vendor:      y.Vendor,
+		Description: y.Description,
+		Category:    y.Category,
+		Challenge:   y.Challenge,
+	}
+}
+
 // Match implements the Signature interface
-func (y *YAMLSignature) Match(probes map[scanner.ProbeType]*scanner.ProbeResult) float64 {
+func (y *YAMLSignature) Match(probes map[scanner.ProbeType]*scanner.ProbeResult) MatchResult {
 	if !y.Enabled {
-		return 0.0
+		return MatchResult{}
 	}
 
-	confidence := 0.0
-	matchedIndicators := 0
+	order := probeOrder(probes)
+	var result MatchResult
 
 	for _, indicator := range y.Indicators {
-		if y.matchIndicator(indicator, probes) {
-			confidence += indicator.Confidence
-			matchedIndicators++
+		if evidence, ok := y.matchIndicator(indicator, probes, order); ok {
+			result.Confidence += indicator.Confidence
+			result.Evidence = append(result.Evidence, evidence)
 		}
 	}
 
 	// Apply minimum indicators requirement
-	if y.MinimumIndicators > 0 && matchedIndicators < y.MinimumIndicators {
+	if y.MinimumIndicators > 0 && len(result.Evidence) < y.MinimumIndicators {
 		multiplier := y.ConfidenceMultiplier
 		if multiplier == 0 {
 			multiplier = 0.5 // default
 		}
-		confidence *= multiplier
+		result.Confidence *= multiplier
+		for i := range result.Evidence {
+			result.Evidence[i].Confidence *= multiplier
+		}
 	}
 
 	// Cap at 1.0
-	if confidence > 1.0 {
-		confidence = 1.0
+	if result.Confidence > 1.0 {
+		result.Confidence = 1.0
 	}
 
-	return confidence
+	return result
 }
 
-// matchIndicator checks if a single indicator matches
-func (y *YAMLSignature) matchIndicator(indicator Indicator, probes map[scanner.ProbeType]*scanner.ProbeResult) bool {
-	for _, probe := range probes {
+// matchIndicator checks if a single indicator matches, returning evidence
+// from the first probe in order that it fired on
+func (y *YAMLSignature) matchIndicator(indicator Indicator, probes map[scanner.ProbeType]*scanner.ProbeResult, order []scanner.ProbeType) (Evidence, bool) {
+	if kind, members := indicator.group(); kind != "" {
+		return y.matchGroup(indicator, kind, members, probes, order)
+	}
+
+	if indicator.Differential != "" {
+		return y.matchDifferential(indicator, probes, order)
+	}
+
+	for _, probeType := range order {
+		if !indicator.Probe.allows(probeType) {
+			continue
+		}
+
+		probe := probes[probeType]
 		if probe == nil || probe.Error != nil {
 			continue
 		}
 
-		switch indicator.Type {
-		case IndicatorHeader:
-			if y.matchHeader(indicator, probe) {
-				return true
-			}
-		case IndicatorCookie:
-			if y.matchCookie(indicator, probe) {
-				return true
-			}
-		case IndicatorBody:
-			if y.matchBody(indicator, probe) {
-				return true
-			}
-		case IndicatorStatusCode:
-			if y.matchStatusCode(indicator, probe) {
-				return true
-			}
+		value, ok := y.matchProbe(indicator, probe)
+		if !ok {
+			continue
 		}
+
+		return y.evidence(indicator, probeType, probe, value), true
 	}
-	return false
+	return Evidence{}, false
+}
+
+// matchDifferential checks an indicator whose result must differ between a
+// probe and the baseline, returning evidence from the first probe in order
+// where it does
+func (y *YAMLSignature) matchDifferential(indicator Indicator, probes map[scanner.ProbeType]*scanner.ProbeResult, order []scanner.ProbeType) (Evidence, bool) {
+	baselineType := indicator.baseline()
+	baseline := probes[baselineType]
+	if baseline == nil || baseline.Error != nil {
+		return Evidence{}, false
+	}
+	baselineValue, onBaseline := y.matchProbe(indicator, baseline)
+
+	for _, probeType := range order {
+		if probeType == baselineType || !indicator.Probe.allows(probeType) {
+			continue
+		}
+
+		probe := probes[probeType]
+		if probe == nil || probe.Error != nil {
+			continue
+		}
+		value, onProbe := y.matchProbe(indicator, probe)
+
+		var evidence Evidence
+		switch {
+		case indicator.Differential == DifferentialAppears && onProbe && !onBaseline:
+			evidence = y.evidence(indicator, probeType, probe, value)
+		case indicator.Differential == DifferentialDisappears && onBaseline && !onProbe:
+			// The value only exists on the baseline
+			evidence = y.evidence(indicator, probeType, baseline, baselineValue)
+		default:
+			continue
+		}
+		evidence.Differential = fmt.Sprintf("%s vs %s", indicator.Differential, baselineType)
+		return evidence, true
+	}
+	return Evidence{}, false
+}
+
+// baseline returns the probe a differential indicator is compared with
+func (ind *Indicator) baseline() scanner.ProbeType {
+	if ind.Baseline == "" {
+		return scanner.ProbeNormal
+	}
+	return scanner.ProbeType(ind.Baseline)
+}
+
+// evidence records a plain indicator that matched value on a probe. Regex
+// captures are taken from source, the response the value came from.
+func (y *YAMLSignature) evidence(indicator Indicator, probeType scanner.ProbeType, source *scanner.ProbeResult, value string) Evidence {
+	evidence := Evidence{
+		Type:       string(indicator.Type),
+		Key:        indicator.Key,
+		Condition:  string(indicator.Condition),
+		Value:      truncate(value, maxEvidenceLength),
+		Probe:      string(probeType),
+		Confidence: indicator.Confidence,
+	}
+	if indicator.Condition == ConditionRegex {
+		evidence.Captures = indicator.submatches(y.regexSubject(indicator, source))
+	}
+	return evidence
 }
 
-// matchHeader checks header indicators
-func (y *YAMLSignature) matchHeader(indicator Indicator, probe *scanner.ProbeResult) bool {
-	headerValue := probe.Headers.Get(indicator.Key)
+// matchGroup evaluates an all/any/not group. Each member is matched
+// independently, so members may fire on different probes.
+func (y *YAMLSignature) matchGroup(group Indicator, kind IndicatorType, members []Indicator, probes map[scanner.ProbeType]*scanner.ProbeResult, order []scanner.ProbeType) (Evidence, bool) {
+	evidence := Evidence{
+		Type:       string(kind),
+		Probe:      strings.Join(group.Probe, ","),
+		Confidence: group.Confidence,
+	}
+
+	var absent []string
+	for _, member := range members {
+		if len(member.Probe) == 0 {
+			member.Probe = group.Probe
+		}
+
+		memberEvidence, ok := y.matchIndicator(member, probes, order)
+		switch {
+		case ok && kind == IndicatorNot, !ok && kind == IndicatorAll:
+			return Evidence{}, false
+		case ok:
+			memberEvidence.Confidence = 0
+			evidence.Members = append(evidence.Members, memberEvidence)
+		case kind == IndicatorNot:
+			absent = append(absent, member.describe())
+		}
+	}
 
+	if kind == IndicatorAny && len(evidence.Members) == 0 {
+		return Evidence{}, false
+	}
+	if kind == IndicatorNot {
+		evidence.Value = strings.Join(absent, "; ")
+	}
+	return evidence, true
+}
+
+// group returns the kind and members of a group indicator, or an empty kind
+// for a plain indicator
+func (ind *Indicator) group() (IndicatorType, []Indicator) {
+	switch {
+	case len(ind.All) > 0:
+		return IndicatorAll, ind.All
+	case len(ind.Any) > 0:
+		return IndicatorAny, ind.Any
+	case len(ind.Not) > 0:
+		return IndicatorNot, ind.Not
+	}
+	return "", nil
+}
+
+// describe renders an indicator as a short expression for evidence
+func (ind *Indicator) describe() string {
+	if kind, members := ind.group(); kind != "" {
+		parts := make([]string, 0, len(members))
+		for i := range members {
+			parts = append(parts, members[i].describe())
+		}
+		return fmt.Sprintf("%s(%s)", kind, strings.Join(parts, ", "))
+	}
+
+	parts := []string{string(ind.Type)}
+	if ind.Key != "" {
+		parts = append(parts, ind.Key)
+	}
+	if ind.Attribute != "" {
+		parts = append(parts, ind.Attribute)
+	}
+	parts = append(parts, string(ind.Condition))
+	if ind.Value != "" {
+		parts = append(parts, strconv.Quote(ind.Value))
+	}
+	for _, value := range ind.Values {
+		parts = append(parts, strconv.Quote(value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// prepare validates an indicator, including nested group members, against
+// the known probe names and compiles it
+func (ind *Indicator) prepare(knownProbes map[string]bool) error {
+	for _, probe := range ind.Probe {
+		if !knownProbes[probe] {
+			return fmt.Errorf("unknown probe %q", probe)
+		}
+	}
+
+	switch ind.Differential {
+	case "":
+		if ind.Baseline != "" {
+			return fmt.Errorf("baseline is only used with differential")
+		}
+	case DifferentialAppears, DifferentialDisappears:
+		if ind.Baseline != "" && !knownProbes[ind.Baseline] {
+			return fmt.Errorf("unknown baseline probe %q", ind.Baseline)
+		}
+	default:
+		return fmt.Errorf("unknown differential %q (use appears or disappears)", ind.Differential)
+	}
+
+	groups := 0
+	for _, members := range [][]Indicator{ind.All, ind.Any, ind.Not} {
+		if len(members) > 0 {
+			groups++
+		}
+	}
+	if groups == 0 {
+		return ind.compile()
+	}
+
+	if groups > 1 {
+		return fmt.Errorf("an indicator can only have one of all, any or not")
+	}
+	if ind.Type != "" {
+		return fmt.Errorf("group indicators cannot have a type")
+	}
+	if ind.Differential != "" {
+		return fmt.Errorf("differential is not supported on group indicators")
+	}
+
+	kind, members := ind.group()
+	for i := range members {
+		if err := members[i].prepare(knownProbes); err != nil {
+			return fmt.Errorf("%s[%d]: %w", kind, i, err)
+		}
+	}
+	return nil
+}
+
+// matchProbe checks a single indicator against a single probe and returns
+// the value that matched
+func (y *YAMLSignature) matchProbe(indicator Indicator, probe *scanner.ProbeResult) (string, bool) {
+	switch indicator.Type {
+	case IndicatorHeader:
+		return y.matchHeader(indicator, probe)
+	case IndicatorCookie:
+		return y.matchCookie(indicator, probe)
+	case IndicatorBody:
+		return y.matchBody(indicator, probe)
+	case IndicatorStatusCode:
+		return y.matchStatusCode(indicator, probe)
+	case IndicatorTLS:
+		return y.matchTLS(indicator, probe)
+	}
+	return "", false
+}
+
+// matchHeader checks header indicators. With a prefix or regex match the
+// first selected header that satisfies the condition is reported as
+// "Name: value".
+func (y *YAMLSignature) matchHeader(indicator Indicator, probe *scanner.ProbeResult) (string, bool) {
+	name, value, ok := y.findHeader(indicator, probe)
+	if !ok || indicator.Match == "" || indicator.Match == KeyMatchExact {
+		return value, ok
+	}
+	return name + ": " + value, true
+}
+
+// findHeader returns the first header selected by the indicator's key, in
+// name order, whose value satisfies its condition
+func (y *YAMLSignature) findHeader(indicator Indicator, probe *scanner.ProbeResult) (string, string, bool) {
+	if indicator.Match == "" || indicator.Match == KeyMatchExact {
+		value := probe.Headers.Get(indicator.Key)
+		return indicator.Key, value, y.matchHeaderValue(indicator, value)
+	}
+
+	names := make([]string, 0, len(probe.Headers))
+	for name := range probe.Headers {
+		if indicator.matchHeaderName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := probe.Headers.Get(name)
+		if y.matchHeaderValue(indicator, value) {
+			return name, value, true
+		}
+	}
+	return "", "", false
+}
+
+// matchHeaderName reports whether a header name is selected by a prefix or
+// regex key. Header names are compared case-insensitively.
+func (ind *Indicator) matchHeaderName(name string) bool {
+	if ind.Match == KeyMatchRegex {
+		return ind.keyPattern != nil && ind.keyPattern.MatchString(name)
+	}
+	return strings.HasPrefix(strings.ToLower(name), strings.ToLower(ind.Key))
+}
+
+// matchHeaderValue applies the indicator's condition to a header value
+func (y *YAMLSignature) matchHeaderValue(indicator Indicator, value string) bool {
 	switch indicator.Condition {
 	case ConditionExists:
-		return headerValue != ""
+		return value != ""
 	case ConditionContains:
-		return y.matchString(headerValue, indicator)
+		return y.matchString(value, indicator)
 	case ConditionEquals:
 		if indicator.CaseInsensitive {
-			return strings.EqualFold(headerValue, indicator.Value)
+			return strings.EqualFold(value, indicator.Value)
 		}
-		return headerValue == indicator.Value
+		return value == indicator.Value
+	case ConditionRegex:
+		_, ok := indicator.matchRegex(value)
+		return value != "" && ok
 	}
 	return false
 }
 
-// matchCookie checks cookie indicators
-func (y *YAMLSignature) matchCookie(indicator Indicator, probe *scanner.ProbeResult) bool {
-	cookieHeader := probe.Headers.Get("Set-Cookie")
-	if cookieHeader == "" {
-		return false
+// matchCookie checks cookie indicators against every Set-Cookie header and
+// returns the cookie that matched
+func (y *YAMLSignature) matchCookie(indicator Indicator, probe *scanner.ProbeResult) (string, bool) {
+	c, target, ok := y.findCookie(indicator, probe)
+	if !ok {
+		return "", false
+	}
+
+	if indicator.Attribute == "" {
+		return c.Name + "=" + c.Value, true
+	}
+	if target == "" {
+		return c.Name + "; " + indicator.Attribute, true
+	}
+	return c.Name + "; " + indicator.Attribute + "=" + target, true
+}
+
+// findCookie returns the first cookie selected by the indicator's key that
+// satisfies its condition, along with the value the condition was applied to
+func (y *YAMLSignature) findCookie(indicator Indicator, probe *scanner.ProbeResult) (cookie, string, bool) {
+	for _, c := range parseSetCookies(probe.Headers) {
+		if !indicator.matchCookieName(c.Name) {
+			continue
+		}
+
+		target := c.Value
+		if indicator.Attribute != "" {
+			value, ok := c.Attributes[strings.ToLower(indicator.Attribute)]
+			if !ok {
+				continue
+			}
+			target = value
+		}
+
+		if y.matchCookieValue(indicator, target) {
+			return c, target, true
+		}
 	}
+	return cookie{}, "", false
+}
 
+// matchCookieValue applies the indicator's condition to a cookie or
+// attribute value. A contains condition without values only requires the
+// cookie to be present.
+func (y *YAMLSignature) matchCookieValue(indicator Indicator, value string) bool {
 	switch indicator.Condition {
 	case ConditionExists:
-		return strings.Contains(cookieHeader, indicator.Key)
+		return true
 	case ConditionContains:
-		return y.matchString(cookieHeader, indicator)
+		if indicator.Value == "" && len(indicator.Values) == 0 {
+			return true
+		}
+		return y.matchString(value, indicator)
+	case ConditionEquals:
+		if indicator.CaseInsensitive {
+			return strings.EqualFold(value, indicator.Value)
+		}
+		return value == indicator.Value
+	case ConditionRegex:
+		_, ok := indicator.matchRegex(value)
+		return ok
 	}
 	return false
 }
 
-// matchBody checks body content indicators
-func (y *YAMLSignature) matchBody(indicator Indicator, probe *scanner.ProbeResult) bool {
+// matchBody checks body content indicators and returns an excerpt around
+// the first match
+func (y *YAMLSignature) matchBody(indicator Indicator, probe *scanner.ProbeResult) (string, bool) {
 	// Check status code filter if specified
 	if len(indicator.StatusCodes) > 0 {
 		matched := false
@@ -173,61 +594,79 @@ func (y *YAMLSignature) matchBody(indicator Indicator, probe *scanner.ProbeResul
 			}
 		}
 		if !matched {
-			return false
+			return "", false
 		}
 	}
 
+	// Regex patterns carry their own case folding and must see the original
+	// body so captured values keep their case
+	if indicator.Condition == ConditionRegex {
+		return indicator.matchRegex(probe.Body)
+	}
+
+	if indicator.Condition != ConditionContains {
+		return "", false
+	}
+
 	body := probe.Body
 	if indicator.CaseInsensitive {
 		body = strings.ToLower(body)
 	}
 
-	switch indicator.Condition {
-	case ConditionContains:
-		if len(indicator.Values) > 0 {
+	values := indicator.Values
+	if len(values) == 0 {
+		if indicator.Value == "" {
+			return "", false
+		}
+		values = []string{indicator.Value}
+	}
+
+	first, firstLen := -1, 0
+	for _, val := range values {
+		searchVal := val
+		if indicator.CaseInsensitive {
+			searchVal = strings.ToLower(val)
+		}
+
+		idx := strings.Index(body, searchVal)
+		if idx < 0 {
 			if indicator.RequireAllValues {
 				// All values must be present
-				for _, val := range indicator.Values {
-					searchVal := val
-					if indicator.CaseInsensitive {
-						searchVal = strings.ToLower(val)
-					}
-					if !strings.Contains(body, searchVal) {
-						return false
-					}
-				}
-				return true
-			} else {
-				// Any value can match
-				for _, val := range indicator.Values {
-					searchVal := val
-					if indicator.CaseInsensitive {
-						searchVal = strings.ToLower(val)
-					}
-					if strings.Contains(body, searchVal) {
-						return true
-					}
-				}
-			}
-		} else if indicator.Value != "" {
-			searchVal := indicator.Value
-			if indicator.CaseInsensitive {
-				searchVal = strings.ToLower(indicator.Value)
+				return "", false
 			}
-			return strings.Contains(body, searchVal)
+			continue
+		}
+
+		if first < 0 {
+			first, firstLen = idx, len(searchVal)
+		}
+		if !indicator.RequireAllValues {
+			// Any value can match
+			break
 		}
 	}
-	return false
+
+	if first < 0 {
+		return "", false
+	}
+	return excerpt(probe.Body, first, firstLen), true
 }
 
 // matchStatusCode checks status code indicators
-func (y *YAMLSignature) matchStatusCode(indicator Indicator, probe *scanner.ProbeResult) bool {
+func (y *YAMLSignature) matchStatusCode(indicator Indicator, probe *scanner.ProbeResult) (string, bool) {
+	status := strconv.Itoa(probe.StatusCode)
+
+	if indicator.Condition == ConditionRegex {
+		_, ok := indicator.matchRegex(status)
+		return status, probe.StatusCode != 0 && ok
+	}
+
 	for _, code := range indicator.StatusCodes {
 		if probe.StatusCode == code {
-			return true
+			return status, true
 		}
 	}
-	return false
+	return "", false
 }
 
 // matchString is a helper for string matching
@@ -256,44 +695,450 @@ func (y *YAMLSignature) matchString(value string, indicator Indicator) bool {
 	return strings.Contains(value, searchVal)
 }
 
+// compile validates an indicator and prepares it for matching. Regex patterns
+// are compiled once here so a bad expression is reported at load time, not
+// mid-scan.
+func (ind *Indicator) compile() error {
+	if ind.Attribute != "" && ind.Type != IndicatorCookie {
+		return fmt.Errorf("attribute is only supported for cookie indicators")
+	}
+	if ind.Match != "" && ind.Type != IndicatorHeader && ind.Type != IndicatorCookie {
+		return fmt.Errorf("match is only supported for header and cookie indicators")
+	}
+	if ind.Type == IndicatorTLS {
+		if err := checkTLSKey(ind.Key); err != nil {
+			return err
+		}
+	}
+
+	switch ind.Match {
+	case "", KeyMatchPrefix, KeyMatchExact:
+	case KeyMatchRegex:
+		if ind.Key == "" {
+			return fmt.Errorf("regex %s match needs a key", ind.Type)
+		}
+		// Header names are case-insensitive in HTTP
+		pattern := ind.Key
+		if ind.CaseInsensitive || ind.Type == IndicatorHeader {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid %s name regex %q: %w", ind.Type, ind.Key, err)
+		}
+		ind.keyPattern = re
+	default:
+		return fmt.Errorf("unknown %s match %q", ind.Type, ind.Match)
+	}
+
+	if ind.Condition != ConditionRegex {
+		return nil
+	}
+
+	patterns := ind.Values
+	if len(patterns) == 0 {
+		patterns = []string{ind.Value}
+	}
+
+	ind.patterns = make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return fmt.Errorf("empty regex pattern")
+		}
+		if ind.CaseInsensitive {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regex %q: %w", pattern, err)
+		}
+		ind.patterns = append(ind.patterns, re)
+	}
+
+	return nil
+}
+
+// matchRegex reports whether value matches the indicator's patterns, honouring
+// require_all_values, and returns the text matched by the first pattern
+func (ind *Indicator) matchRegex(value string) (string, bool) {
+	if len(ind.patterns) == 0 {
+		return "", false
+	}
+
+	matchedText := ""
+	for _, re := range ind.patterns {
+		loc := re.FindStringIndex(value)
+		if loc != nil && matchedText == "" {
+			matchedText = value[loc[0]:loc[1]]
+		}
+		if loc != nil && !ind.RequireAllValues {
+			return matchedText, true
+		}
+		if loc == nil && ind.RequireAllValues {
+			return "", false
+		}
+	}
+	return matchedText, ind.RequireAllValues
+}
+
+// submatches returns the named capture groups the indicator's patterns find in value
+func (ind *Indicator) submatches(value string) map[string]string {
+	var captures map[string]string
+	for _, re := range ind.patterns {
+		match := re.FindStringSubmatch(value)
+		if match == nil {
+			continue
+		}
+		for i, name := range re.SubexpNames() {
+			if name == "" || match[i] == "" {
+				continue
+			}
+			if captures == nil {
+				captures = make(map[string]string)
+			}
+			captures[name] = match[i]
+		}
+	}
+	return captures
+}
+
+// regexSubject returns the probe value a regex indicator is evaluated against
+func (y *YAMLSignature) regexSubject(indicator Indicator, probe *scanner.ProbeResult) string {
+	switch indicator.Type {
+	case IndicatorHeader:
+		_, value, _ := y.findHeader(indicator, probe)
+		return value
+	case IndicatorCookie:
+		_, target, _ := y.findCookie(indicator, probe)
+		return target
+	case IndicatorBody:
+		return probe.Body
+	case IndicatorStatusCode:
+		return strconv.Itoa(probe.StatusCode)
+	case IndicatorTLS:
+		value, _ := y.matchTLS(indicator, probe)
+		return value
+	}
+	return ""
+}
+
+// maxEvidenceLength caps the size of matched values kept as evidence
+const maxEvidenceLength = 120
+
+// probeOrder returns the probe types present in probes: built-in probes in
+// scan order, then custom probes by name, so evidence is stable across runs
+func probeOrder(probes map[scanner.ProbeType]*scanner.ProbeResult) []scanner.ProbeType {
+	order := make([]scanner.ProbeType, 0, len(probes))
+	builtin := make(map[scanner.ProbeType]bool)
+	for _, probeType := range scanner.BuiltinProbeTypes() {
+		builtin[probeType] = true
+		if _, ok := probes[probeType]; ok {
+			order = append(order, probeType)
+		}
+	}
+
+	custom := make([]string, 0, len(probes))
+	for probeType := range probes {
+		if !builtin[probeType] {
+			custom = append(custom, string(probeType))
+		}
+	}
+	sort.Strings(custom)
+	for _, name := range custom {
+		order = append(order, scanner.ProbeType(name))
+	}
+
+	return order
+}
+
+// excerpt returns the match at body[start:start+length] with some surrounding context
+func excerpt(body string, start, length int) string {
+	const context = 30
+
+	from := start - context
+	if from < 0 {
+		from = 0
+	}
+	to := start + length + context
+	if to > len(body) {
+		to = len(body)
+	}
+	if from > to {
+		return ""
+	}
+
+	snippet := strings.ToValidUTF8(body[from:to], "")
+	snippet = strings.Join(strings.Fields(snippet), " ")
+	if from > 0 {
+		snippet = "..." + snippet
+	}
+	if to < len(body) {
+		snippet += "..."
+	}
+	return snippet
+}
+
+// truncate shortens s to at most n bytes, marking the cut
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "") + "..."
+}
+
 // LoadSignaturesFromYAML loads signatures from a YAML file
 func LoadSignaturesFromYAML(filename string) ([]Signature, error) {
+	set, err := LoadSignatureSetFromYAML(filename)
+	if err != nil {
+		return nil, err
+	}
+	return set.Signatures, nil
+}
+
+// LoadSignatureSetFromYAML loads signatures and custom probes from a YAML file
+func LoadSignatureSetFromYAML(filename string) (*SignatureSet, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read signatures file: %w", err)
 	}
 
-	return parseSignaturesFromBytes(data)
+	return parseSignatureSetFromBytes(data)
 }
 
 // parseSignaturesFromBytes parses YAML signature data from bytes
 func parseSignaturesFromBytes(data []byte) ([]Signature, error) {
+	set, err := parseSignatureSetFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return set.Signatures, nil
+}
+
+// parseSignatureSetFromBytes parses YAML signature and probe data from bytes
+func parseSignatureSetFromBytes(data []byte) (*SignatureSet, error) {
+	config, err := parseSignaturesConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	return config.build()
+}
+
+// parseSignaturesConfig decodes a signatures file without validating it
+func parseSignaturesConfig(data []byte) (*SignaturesConfig, error) {
 	var config SignaturesConfig
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse signatures YAML: %w", err)
 	}
+	return &config, nil
+}
+
+// build validates the probes and indicators and returns the enabled signatures
+func (c *SignaturesConfig) build() (*SignatureSet, error) {
+	knownProbes := make(map[string]bool)
+	for _, probeType := range scanner.BuiltinProbeTypes() {
+		knownProbes[string(probeType)] = true
+	}
+	for _, probe := range c.Probes {
+		if err := probe.Validate(); err != nil {
+			return nil, err
+		}
+		if knownProbes[probe.Name] {
+			return nil, fmt.Errorf("duplicate probe %q", probe.Name)
+		}
+		knownProbes[probe.Name] = true
+	}
+
+	if err := c.Detection.validate(knownProbes); err != nil {
+		return nil, err
+	}
+	detection := DefaultDetectionPolicy().merge(c.Detection)
+	if detection.MinBlockedProbes > len(detection.Probes) {
+		return nil, fmt.Errorf("min_blocked_probes %d is unreachable with %d detection probes", detection.MinBlockedProbes, len(detection.Probes))
+	}
+
+	for i := range c.Signatures {
+		sig := &c.Signatures[i]
+		if sig.Challenge != "" && !validChallengeType(sig.Challenge) {
+			return nil, fmt.Errorf("signature %q: unknown challenge type %q", sig.WAFName, sig.Challenge)
+		}
+		for j := range sig.Indicators {
+			if err := sig.Indicators[j].prepare(knownProbes); err != nil {
+				return nil, fmt.Errorf("signature %q indicator %d: %w", sig.WAFName, j, err)
+			}
+		}
+	}
+
+	signatures := make([]Signature, 0, len(c.Signatures))
+	for i := range c.Signatures {
+		if c.Signatures[i].Enabled {
+			signatures = append(signatures, &c.Signatures[i])
+		}
+	}
+
+	return &SignatureSet{
+		Signatures: signatures,
+		Probes:     c.Probes,
+		Detection:  detection,
+	}, nil
+}
+
+// merge overlays the signatures, probes and detection policy of other.
+// Entries replace earlier ones with the same name in place, so a disabled
+// entry removes a signature; new entries are appended.
+func (c *SignaturesConfig) merge(other *SignaturesConfig) {
+	c.Detection = c.Detection.merge(other.Detection)
+
+	signatures := make(map[string]int, len(c.Signatures))
+	for i, sig := range c.Signatures {
+		signatures[signatureKey(sig.WAFName)] = i
+	}
+	for _, sig := range other.Signatures {
+		key := signatureKey(sig.WAFName)
+		if i, ok := signatures[key]; ok {
+			c.Signatures[i] = sig
+			continue
+		}
+		signatures[key] = len(c.Signatures)
+		c.Signatures = append(c.Signatures, sig)
+	}
+
+	probes := make(map[string]int, len(c.Probes))
+	for i, probe := range c.Probes {
+		probes[probe.Name] = i
+	}
+	for _, probe := range other.Probes {
+		if i, ok := probes[probe.Name]; ok {
+			c.Probes[i] = probe
+			continue
+		}
+		probes[probe.Name] = len(c.Probes)
+		c.Probes = append(c.Probes, probe)
+	}
+}
+
+// validChallengeType reports whether t is one of ChallengeTypes
+func validChallengeType(t ChallengeType) bool {
+	for _, known := range ChallengeTypes() {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureKey is the name signatures are merged by, ignoring case
+func signatureKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// SignatureFiles expands paths to the signatures files they name. A
+// directory contributes its .yml and .yaml files in name order.
+func SignatureFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signatures: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signatures: %w", err)
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if !entry.IsDir() && (ext == ".yml" || ext == ".yaml") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// LoadMergedSignatureSet merges the signatures files at paths over the
+// embedded signatures, in order; directories are expanded by SignatureFiles.
+// A signature or probe replaces an earlier one with the same name, so a file
+// can override a built-in signature or disable it with just its name and
+// enabled: false.
+func LoadMergedSignatureSet(paths ...string) (*SignatureSet, error) {
+	data, err := embeddedSignatures.ReadFile("waf-signatures.yml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded signatures: %w", err)
+	}
+	config, err := parseSignaturesConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := config.build()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := SignatureFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	// Each file is validated against the files before it, so errors name
+	// the file that caused them
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signatures file: %w", err)
+		}
+		overlay, err := parseSignaturesConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		config.merge(overlay)
 
-	signatures := make([]Signature, 0, len(config.Signatures))
-	for i := range config.Signatures {
-		if config.Signatures[i].Enabled {
-			signatures = append(signatures, &config.Signatures[i])
+		if set, err = config.build(); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
 		}
 	}
 
-	return signatures, nil
+	return set, nil
 }
 
-// GetSignatures returns either YAML-loaded signatures or default hardcoded ones
+// GetSignatures returns the signatures of a YAML file, or the embedded ones
 func GetSignatures(yamlPath string) []Signature {
+	return GetSignatureSet(yamlPath).Signatures
+}
+
+// GetSignatureSet returns the signatures and custom probes of a YAML file, or
+// the defaults if the file cannot be loaded
+func GetSignatureSet(yamlPath string) *SignatureSet {
 	if yamlPath != "" {
-		signatures, err := LoadSignaturesFromYAML(yamlPath)
-		if err == nil && len(signatures) > 0 {
-			return signatures
+		// Fall back to default if YAML loading fails or finds no signatures
+		set, err := LoadSignatureSetFromYAML(yamlPath)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Warning: Failed to load YAML signatures (%v), using defaults\n", err)
+		case len(set.Signatures) == 0:
+			fmt.Fprintf(os.Stderr, "Warning: %s has no enabled signatures, using defaults\n", yamlPath)
+		default:
+			return set
 		}
-		// Fall back to default if YAML loading fails
-		fmt.Fprintf(os.Stderr, "Warning: Failed to load YAML signatures (%v), using defaults\n", err)
 	}
 
-	// Return hardcoded defaults
-	return GetAllSignatures()
+	// Return the embedded signatures
+	return &SignatureSet{Signatures: GetAllSignatures(), Detection: DefaultDetectionPolicy()}
+}
+
+// GetMergedSignatureSet returns the embedded signatures merged with the files
+// at paths. Unlike LoadMergedSignatureSet it also fails when the files
+// disable every signature, since such a scan cannot detect anything.
+func GetMergedSignatureSet(paths []string) (*SignatureSet, error) {
+	set, err := LoadMergedSignatureSet(paths...)
+	if err != nil {
+		return nil, err
+	}
+	if len(set.Signatures) == 0 {
+		return nil, fmt.Errorf("every signature is disabled by %s", strings.Join(paths, ", "))
+	}
+	return set, nil
 }
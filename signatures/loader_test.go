@@ -0,0 +1,842 @@
+package signatures
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ahmedtouahria/waf-detector/scanner"
+)
+
+func TestRegexIndicators(t *testing.T) {
+	data := []byte(`
+version: "1.0"
+signatures:
+  - name: "Regex WAF"
+    enabled: true
+    indicators:
+      - type: header
+        key: "X-Request-ID"
+        condition: regex
+        value: '^[a-f0-9]{8}-edge$'
+        confidence: 0.3
+      - type: body
+        condition: regex
+        value: 'incident id:?\s*(?P<incident_id>[0-9]+-[0-9]+)'
+        case_insensitive: true
+        status_codes: [403]
+        confidence: 0.4
+      - type: status_code
+        condition: regex
+        value: '^5\d\d$'
+        confidence: 0.2
+`)
+
+	sigs, err := parseSignaturesFromBytes(data)
+	if err != nil {
+		t.Fatalf("parseSignaturesFromBytes failed: %v", err)
+	}
+
+	probes := map[scanner.ProbeType]*scanner.ProbeResult{
+		scanner.ProbeNormal: {
+			StatusCode: 200,
+			Headers:    http.Header{"X-Request-Id": {"deadbeef-edge"}},
+			Body:       "Welcome",
+		},
+		scanner.ProbeSQLi: {
+			StatusCode: 403,
+			Headers:    http.Header{},
+			Body:       "Request unsuccessful. Incapsula Incident ID: 1234000230160934497-9316518046533122",
+		},
+	}
+
+	match := sigs[0].Match(probes)
+	if match.Confidence < 0.69 || match.Confidence > 0.71 {
+		t.Errorf("Match() = %.2f, want 0.70", match.Confidence)
+	}
+	if len(match.Evidence) != 2 {
+		t.Fatalf("Evidence = %+v, want 2 entries", match.Evidence)
+	}
+
+	body := match.Evidence[1]
+	if body.Probe != string(scanner.ProbeSQLi) {
+		t.Errorf("body evidence probe = %s, want sqli", body.Probe)
+	}
+	if got := body.Captures["incident_id"]; got != "1234000230160934497-9316518046533122" {
+		t.Errorf("incident_id capture = %q", got)
+	}
+}
+
+func TestMatchEvidence(t *testing.T) {
+	data := []byte(`
+version: "1.0"
+signatures:
+  - name: "Evidence WAF"
+    enabled: true
+    minimum_indicators: 3
+    confidence_multiplier: 0.5
+    indicators:
+      - type: header
+        key: "X-Edge"
+        condition: exists
+        confidence: 0.4
+      - type: body
+        condition: contains
+        values: ["request blocked"]
+        case_insensitive: true
+        confidence: 0.4
+`)
+
+	sigs, err := parseSignaturesFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	probes := map[scanner.ProbeType]*scanner.ProbeResult{
+		scanner.ProbeNormal: {StatusCode: 200, Headers: http.Header{"X-Edge": {"pop-12"}}, Body: "ok"},
+		scanner.ProbeXSS:    {StatusCode: 403, Headers: http.Header{}, Body: "<h1>Request Blocked</h1>"},
+	}
+
+	match := sigs[0].Match(probes)
+	want := []Evidence{
+		{Type: "header", Key: "X-Edge", Condition: "exists", Value: "pop-12", Probe: "normal", Confidence: 0.2},
+		{Type: "body", Condition: "contains", Value: "<h1>Request Blocked</h1>", Probe: "xss", Confidence: 0.2},
+	}
+	if len(match.Evidence) != len(want) {
+		t.Fatalf("Evidence = %+v", match.Evidence)
+	}
+	for i, got := range match.Evidence {
+		if got.Type != want[i].Type || got.Key != want[i].Key || got.Value != want[i].Value ||
+			got.Probe != want[i].Probe || got.Confidence != want[i].Confidence {
+			t.Errorf("Evidence[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestInvalidRegexRejected(t *testing.T) {
+	data := []byte(`
+version: "1.0"
+signatures:
+  - name: "Broken WAF"
+    enabled: true
+    indicators:
+      - type: header
+        key: "Server"
+        condition: exists
+        confidence: 0.3
+      - type: body
+        condition: regex
+        value: "incident id: ("
+        confidence: 0.4
+`)
+
+	_, err := parseSignaturesFromBytes(data)
+	if err == nil {
+		t.Fatal("expected error for invalid regex")
+	}
+	if !strings.Contains(err.Error(), `"Broken WAF"`) || !strings.Contains(err.Error(), "indicator 1") {
+		t.Errorf("error should name signature and indicator index, got: %v", err)
+	}
+}
+
+func TestEmbeddedSignaturesLoad(t *testing.T) {
+	data, err := embeddedSignatures.ReadFile("waf-signatures.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseSignaturesFromBytes(data); err != nil {
+		t.Fatalf("embedded signatures failed to load: %v", err)
+	}
+}
+
+func TestCustomProbesAndScopedIndicators(t *testing.T) {
+	data := []byte(`
+version: "1.0"
+probes:
+  - name: "path_traversal"
+    path: "/../../etc/passwd"
+signatures:
+  - name: "Scoped WAF"
+    enabled: true
+    indicators:
+      - type: status_code
+        status_codes: [403]
+        probe: path_traversal
+        confidence: 0.5
+`)
+
+	set, err := parseSignatureSetFromBytes(data)
+	if err != nil {
+		t.Fatalf("parseSignatureSetFromBytes failed: %v", err)
+	}
+	if len(set.Probes) != 1 || set.Probes[0].Type() != "path_traversal" {
+		t.Fatalf("Probes = %+v", set.Probes)
+	}
+
+	blockedElsewhere := map[scanner.ProbeType]*scanner.ProbeResult{
+		scanner.ProbeSQLi: {StatusCode: 403, Headers: http.Header{}},
+		"path_traversal":  {StatusCode: 200, Headers: http.Header{}},
+	}
+	if got := set.Signatures[0].Match(blockedElsewhere).Confidence; got != 0 {
+		t.Errorf("Match() = %.2f, want 0 when only other probes are blocked", got)
+	}
+
+	blocked := map[scanner.ProbeType]*scanner.ProbeResult{
+		"path_traversal": {StatusCode: 403, Headers: http.Header{}},
+	}
+	if got := set.Signatures[0].Match(blocked).Confidence; got != 0.5 {
+		t.Errorf("Match() = %.2f, want 0.50", got)
+	}
+}
+
+func TestUnknownProbeRejected(t *testing.T) {
+	data := []byte(`
+version: "1.0"
+signatures:
+  - name: "Scoped WAF"
+    enabled: true
+    indicators:
+      - type: status_code
+        status_codes: [403]
+        probe: graphql
+        confidence: 0.5
+`)
+
+	if _, err := parseSignatureSetFromBytes(data); err == nil || !strings.Contains(err.Error(), `unknown probe "graphql"`) {
+		t.Errorf("expected unknown probe error, got: %v", err)
+	}
+}
+
+func TestCookieIndicators(t *testing.T) {
+	data := []byte(`
+version: "1.0"
+signatures:
+  - name: "Cookie WAF"
+    enabled: true
+    indicators:
+      - type: cookie
+        key: "visid_incap_"
+        condition: exists
+        confidence: 0.1
+      - type: cookie
+        key: "incap_ses_"
+        condition: contains
+        confidence: 0.1
+      - type: cookie
+        key: "SESSIONID"
+        match: exact
+        condition: equals
+        value: "edge"
+        confidence: 0.1
+      - type: cookie
+        key: '^nlbi_[0-9]+$'
+        match: regex
+        condition: regex
+        value: '^(?P<node>[a-z]+)-'
+        confidence: 0.1
+      - type: cookie
+        key: "incap_ses_"
+        attribute: Domain
+        condition: equals
+        value: ".incapsula.example"
+        case_insensitive: true
+        confidence: 0.1
+      - type: cookie
+        key: "visid_incap_"
+        attribute: SameSite
+        condition: exists
+        confidence: 0.1
+`)
+
+	sigs, err := parseSignaturesFromBytes(data)
+	if err != nil {
+		t.Fatalf("parseSignaturesFromBytes failed: %v", err)
+	}
+
+	header := http.Header{}
+	header.Add("Set-Cookie", "visid_incap_2314=abc; expires=Thu, 01 Jan 2099 00:00:00 GMT; path=/; HttpOnly")
+	header.Add("Set-Cookie", "incap_ses_123_2314=def; path=/; Domain=.Incapsula.example")
+	header.Add("Set-Cookie", "SESSIONID=edge; Secure")
+	header.Add("Set-Cookie", "nlbi_2314=pop-7; path=/")
+
+	match := sigs[0].Match(map[scanner.ProbeType]*scanner.ProbeResult{
+		scanner.ProbeNormal: {StatusCode: 200, Headers: header},
+	})
+
+	// Every indicator except SameSite, which visid_incap_ does not set
+	if len(match.Evidence) != 5 {
+		t.Fatalf("Evidence = %+v, want 5 entries", match.Evidence)
+	}
+	if got := match.Evidence[1].Value; got != "incap_ses_123_2314=def" {
+		t.Errorf("second cookie evidence = %q", got)
+	}
+	if got := match.Evidence[3].Captures["node"]; got != "pop" {
+		t.Errorf("node capture = %q, want pop", got)
+	}
+	if got := match.Evidence[4].Value; got != "incap_ses_123_2314; Domain=.Incapsula.example" {
+		t.Errorf("attribute evidence = %q", got)
+	}
+}
+
+func TestCookieNameNotMatchedInValue(t *testing.T) {
+	data := []byte(`
+version: "1.0"
+signatures:
+  - name: "Cookie WAF"
+    enabled: true
+    indicators:
+      - type: cookie
+        key: "__cfduid"
+        condition: contains
+        confidence: 0.5
+`)
+
+	sigs, err := parseSignaturesFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := http.Header{}
+	header.Add("Set-Cookie", "session=__cfduid-lookalike; path=/")
+	header.Add("Set-Cookie", "theme=dark")
+
+	match := sigs[0].Match(map[scanner.ProbeType]*scanner.ProbeResult{
+		scanner.ProbeNormal: {StatusCode: 200, Headers: header},
+	})
+	if match.Confidence != 0 {
+		t.Errorf("Match() = %.2f, want 0 when only a cookie value contains the key", match.Confidence)
+	}
+}
+
+func TestHeaderKeyMatch(t *testing.T) {
+	data := []byte(`
+version: "1.0"
+signatures:
+  - name: "Prefix WAF"
+    enabled: true
+    indicators:
+      - type: header
+        key: "X-Barracuda-"
+        condition: exists
+        confidence: 0.1
+      - type: header
+        key: "X-Barracuda-"
+        match: prefix
+        condition: contains
+        value: "blocked"
+        confidence: 0.2
+      - type: header
+        key: '^x-amz-(cf|apigw)-id$'
+        match: regex
+        condition: exists
+        confidence: 0.3
+`)
+
+	sigs, err := parseSignaturesFromBytes(data)
+	if err != nil {
+		t.Fatalf("parseSignaturesFromBytes failed: %v", err)
+	}
+
+	header := http.Header{}
+	header.Set("X-Barracuda-Url", "/")
+	header.Set("X-Barracuda-Status", "blocked")
+	header.Set("X-Amz-Cf-Id", "abc")
+
+	match := sigs[0].Match(map[scanner.ProbeType]*scanner.ProbeResult{
+		scanner.ProbeNormal: {StatusCode: 403, Headers: header},
+	})
+	// An exact key never matches a header that only starts with it
+	if match.Confidence < 0.499 || match.Confidence > 0.501 {
+		t.Fatalf("Match() = %.2f, want 0.50 (evidence %+v)", match.Confidence, match.Evidence)
+	}
+	if got := match.Evidence[0].Value; got != "X-Barracuda-Status: blocked" {
+		t.Errorf("prefix evidence = %q, want the header that satisfied the condition", got)
+	}
+	if got := match.Evidence[1].Value; got != "X-Amz-Cf-Id: abc" {
+		t.Errorf("regex evidence = %q", got)
+	}
+}
+
+func TestCookieOptionsValidated(t *testing.T) {
+	tests := []struct {
+		name      string
+		indicator string
+		want      string
+	}{
+		{"match on body", `{type: body, match: exact, condition: contains, value: a}`, "only supported for header and cookie"},
+		{"attribute on header", `{type: header, key: Server, attribute: Domain, condition: exists}`, "attribute is only supported for cookie"},
+		{"unknown match", `{type: cookie, key: a, match: suffix, condition: exists}`, `unknown cookie match "suffix"`},
+		{"bad name regex", `{type: cookie, key: "(", match: regex, condition: exists}`, "invalid cookie name regex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte("version: \"1.0\"\nsignatures:\n  - name: X\n    enabled: true\n    indicators:\n      - " + tt.indicator + "\n")
+			if _, err := parseSignaturesFromBytes(data); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTLSIndicators(t *testing.T) {
+	data := []byte(`
+version: "1.0"
+signatures:
+  - name: "Edge WAF"
+    enabled: true
+    indicators:
+      - type: tls
+        key: san
+        condition: contains
+        value: "cloudflaressl.com"
+        confidence: 0.3
+      - type: tls
+        key: issuer
+        condition: regex
+        value: 'O=(?P<issuer_org>Cloudflare)'
+        confidence: 0.2
+      - type: tls
+        key: alpn
+        condition: equals
+        value: "h2"
+        confidence: 0.1
+      - type: tls
+        key: version
+        condition: equals
+        value: "TLS 1.2"
+        confidence: 0.1
+`)
+
+	sigs, err := parseSignaturesFromBytes(data)
+	if err != nil {
+		t.Fatalf("parseSignaturesFromBytes failed: %v", err)
+	}
+
+	tls := &scanner.TLSInfo{
+		Version: "TLS 1.3",
+		ALPN:    "h2",
+		Issuer:  `CN=Cloudflare Inc ECC CA-3,O=Cloudflare\, Inc.,C=US`,
+		SANs:    []string{"example.com", "sni.cloudflaressl.com"},
+	}
+	match := sigs[0].Match(map[scanner.ProbeType]*scanner.ProbeResult{
+		scanner.ProbeNormal: {StatusCode: 200, TLS: tls},
+	})
+	if match.Confidence < 0.599 || match.Confidence > 0.601 || len(match.Evidence) != 3 {
+		t.Fatalf("Match() = %.2f, want 0.60 (evidence %+v)", match.Confidence, match.Evidence)
+	}
+	if got := match.Evidence[0]; got.Type != "tls" || got.Key != "san" || got.Value != "sni.cloudflaressl.com" {
+		t.Errorf("san evidence = %+v, want the SAN that matched", got)
+	}
+	if got := match.Evidence[1].Captures["issuer_org"]; got != "Cloudflare" {
+		t.Errorf("issuer captures = %v, want issuer_org", match.Evidence[1].Captures)
+	}
+
+	// Plain HTTP responses have no TLS details
+	match = sigs[0].Match(map[scanner.ProbeType]*scanner.ProbeResult{
+		scanner.ProbeNormal: {StatusCode: 200},
+	})
+	if match.Confidence != 0 {
+		t.Errorf("Match() over plain http = %.2f, want 0", match.Confidence)
+	}
+
+	for indicator, want := range map[string]string{
+		`{type: tls, condition: exists}`:                          "tls indicators need a key",
+		`{type: tls, key: fingerprint, condition: exists}`:        `unknown tls key "fingerprint"`,
+		`{type: tls, key: san, match: prefix, condition: exists}`: "only supported for header and cookie",
+	} {
+		data := []byte("version: \"1.0\"\nsignatures:\n  - name: X\n    enabled: true\n    indicators:\n      - " + indicator + "\n")
+		if _, err := parseSignaturesFromBytes(data); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error = %v, want %q", indicator, err, want)
+		}
+	}
+}
+
+func TestIndicatorGroups(t *testing.T) {
+	data := []byte(`
+version: "1.0"
+signatures:
+  - name: "Group WAF"
+    enabled: true
+    indicators:
+      - all:
+          - type: header
+            key: "Server"
+            condition: contains
+            value: "nginx"
+          - type: body
+            condition: contains
+            value: "ModSecurity"
+          - not:
+              - type: header
+                key: "X-Sucuri-ID"
+                condition: exists
+        confidence: 0.5
+      - any:
+          - type: status_code
+            status_codes: [406]
+          - type: status_code
+            status_codes: [501]
+        probe: sqli
+        confidence: 0.2
+`)
+
+	sigs, err := parseSignaturesFromBytes(data)
+	if err != nil {
+		t.Fatalf("parseSignaturesFromBytes failed: %v", err)
+	}
+
+	probes := func(sucuri bool, sqliStatus int) map[scanner.ProbeType]*scanner.ProbeResult {
+		header := http.Header{"Server": {"nginx/1.24"}}
+		if sucuri {
+			header.Set("X-Sucuri-ID", "18012")
+		}
+		return map[scanner.ProbeType]*scanner.ProbeResult{
+			scanner.ProbeNormal: {StatusCode: 200, Headers: header, Body: "ok"},
+			scanner.ProbeSQLi:   {StatusCode: sqliStatus, Headers: header, Body: "blocked by ModSecurity"},
+			scanner.ProbeXSS:    {StatusCode: 501, Headers: header},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		sucuri     bool
+		sqliStatus int
+		want       float64
+	}{
+		{"all and any", false, 406, 0.7},
+		{"excluded by not", true, 406, 0.2},
+		{"any scoped to sqli probe", false, 403, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := sigs[0].Match(probes(tt.sucuri, tt.sqliStatus))
+			if match.Confidence < tt.want-0.001 || match.Confidence > tt.want+0.001 {
+				t.Errorf("Match() = %.2f, want %.2f (evidence %+v)", match.Confidence, tt.want, match.Evidence)
+			}
+		})
+	}
+
+	match := sigs[0].Match(probes(false, 406))
+	group := match.Evidence[0]
+	if group.Type != "all" || len(group.Members) != 3 {
+		t.Fatalf("group evidence = %+v", group)
+	}
+	if not := group.Members[2]; not.Type != "not" || not.Value != "header X-Sucuri-ID exists" {
+		t.Errorf("not evidence = %+v", not)
+	}
+	if got := group.String(); !strings.Contains(got, `all (+0.50) [header Server contains "nginx/1.24" on normal probe;`) {
+		t.Errorf("String() = %s", got)
+	}
+}
+
+func TestIndicatorGroupsValidated(t *testing.T) {
+	tests := []struct {
+		name      string
+		indicator string
+		want      string
+	}{
+		{"type and group", `{type: header, all: [{type: body, condition: contains, value: x}]}`, "cannot have a type"},
+		{"two groups", `{all: [{type: body, condition: contains, value: x}], not: [{type: body, condition: contains, value: y}]}`, "only have one of"},
+		{"nested error", `{any: [{type: body, condition: regex, value: "("}]}`, "indicator 0: any[0]: invalid regex"},
+		{"nested probe", `{not: [{type: status_code, status_codes: [403], probe: graphql}]}`, `not[0]: unknown probe "graphql"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte("version: \"1.0\"\nsignatures:\n  - name: X\n    enabled: true\n    indicators:\n      - " + tt.indicator + "\n")
+			if _, err := parseSignaturesFromBytes(data); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeListsAndDifferential(t *testing.T) {
+	data := []byte(`
+version: "1.0"
+signatures:
+  - name: "Differential WAF"
+    enabled: true
+    indicators:
+      - type: status_code
+        status_codes: [403]
+        probe: [sqli, xss]
+        confidence: 0.1
+      - type: header
+        key: "X-Cache"
+        condition: exists
+        probe: sqli
+        differential: disappears
+        confidence: 0.2
+      - type: body
+        condition: regex
+        value: 'blocked \(ref (?P<ref>[0-9]+)\)'
+        differential: appears
+        confidence: 0.3
+      - type: header
+        key: "Server"
+        condition: exists
+        differential: appears
+        confidence: 0.4
+`)
+
+	sigs, err := parseSignaturesFromBytes(data)
+	if err != nil {
+		t.Fatalf("parseSignaturesFromBytes failed: %v", err)
+	}
+
+	probes := map[scanner.ProbeType]*scanner.ProbeResult{
+		scanner.ProbeNormal:    {StatusCode: 200, Headers: http.Header{"X-Cache": {"HIT"}, "Server": {"edge"}}, Body: "welcome"},
+		scanner.ProbeSQLi:      {StatusCode: 403, Headers: http.Header{"Server": {"edge"}}, Body: "blocked (ref 42)"},
+		scanner.ProbeMalformed: {StatusCode: 403, Headers: http.Header{"Server": {"edge"}}},
+	}
+
+	match := sigs[0].Match(probes)
+	// Server is present on both sides, so its differential does not fire
+	if match.Confidence < 0.599 || match.Confidence > 0.601 {
+		t.Fatalf("Match() = %.2f, want 0.60 (evidence %+v)", match.Confidence, match.Evidence)
+	}
+
+	disappeared := match.Evidence[1]
+	if disappeared.Probe != "sqli" || disappeared.Value != "HIT" || disappeared.Differential != "disappears vs normal" {
+		t.Errorf("disappears evidence = %+v", disappeared)
+	}
+	if got := disappeared.String(); got != `header X-Cache exists "HIT" on sqli probe, disappears vs normal (+0.20)` {
+		t.Errorf("String() = %s", got)
+	}
+	if got := match.Evidence[2].Captures["ref"]; got != "42" {
+		t.Errorf("ref capture = %q, want 42", got)
+	}
+
+	// A block page that is also served to the normal request is not a difference
+	probes[scanner.ProbeNormal].Body = "blocked (ref 1)"
+	if got := sigs[0].Match(probes).Confidence; got < 0.299 || got > 0.301 {
+		t.Errorf("Match() = %.2f, want 0.30 once the baseline matches too", got)
+	}
+}
+
+func TestDifferentialValidated(t *testing.T) {
+	tests := []struct {
+		name      string
+		indicator string
+		want      string
+	}{
+		{"unknown mode", `{type: header, key: A, condition: exists, differential: changes}`, `unknown differential "changes"`},
+		{"unknown baseline", `{type: header, key: A, condition: exists, differential: appears, baseline: graphql}`, `unknown baseline probe "graphql"`},
+		{"baseline alone", `{type: header, key: A, condition: exists, baseline: sqli}`, "only used with differential"},
+		{"unknown probe in list", `{type: header, key: A, condition: exists, probe: [sqli, graphql]}`, `unknown probe "graphql"`},
+		{"group", `{differential: appears, all: [{type: header, key: A, condition: exists}]}`, "not supported on group"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte("version: \"1.0\"\nsignatures:\n  - name: X\n    enabled: true\n    indicators:\n      - " + tt.indicator + "\n")
+			if _, err := parseSignaturesFromBytes(data); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMergedSignatureSet(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// Files in a directory apply in name order, so 20-vendor.yml overrides
+	// the probe and signature from 10-probes.yml
+	write("signatures.d/10-probes.yml", `
+probes:
+  - name: traversal
+    path: /?file=../../etc/passwd
+signatures:
+  - name: Vendor WAF
+    enabled: true
+    indicators:
+      - type: status_code
+        status_codes: [406]
+        confidence: 0.4
+`)
+	write("signatures.d/20-vendor.yml", `
+probes:
+  - name: traversal
+    path: /?file=..%2f..%2fetc%2fpasswd
+signatures:
+  - name: Vendor WAF
+    enabled: true
+    indicators:
+      - type: header
+        key: X-Vendor-WAF
+        condition: exists
+        probe: traversal
+        confidence: 0.9
+`)
+	write("signatures.d/notes.txt", "not a signatures file")
+	overrides := write("overrides.yml", `
+signatures:
+  - name: cloudflare
+    enabled: false
+  - name: Sucuri CloudProxy WAF
+    enabled: true
+    indicators:
+      - type: header
+        key: X-Sucuri-ID
+        condition: exists
+        confidence: 0.5
+`)
+
+	set, err := LoadMergedSignatureSet(filepath.Join(dir, "signatures.d"), overrides)
+	if err != nil {
+		t.Fatalf("LoadMergedSignatureSet() error = %v", err)
+	}
+
+	byName := make(map[string]*YAMLSignature)
+	for _, sig := range set.Signatures {
+		byName[sig.Name()] = sig.(*YAMLSignature)
+	}
+	// Overrides keep their position, disabled signatures drop out and new
+	// ones are appended
+	var want []string
+	for _, sig := range GetAllSignatures() {
+		if sig.Name() != "Cloudflare" {
+			want = append(want, sig.Name())
+		}
+	}
+	want = append(want, "Vendor WAF")
+	got := make([]string, len(set.Signatures))
+	for i, sig := range set.Signatures {
+		got[i] = sig.Name()
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("signatures = %q, want %q", got, want)
+	}
+	if sig := byName["Sucuri CloudProxy WAF"]; sig == nil || len(sig.Indicators) != 1 {
+		t.Errorf("Sucuri CloudProxy WAF should be replaced by the override, got %+v", sig)
+	}
+	if sig := byName["Vendor WAF"]; sig == nil || sig.Indicators[0].Key != "X-Vendor-WAF" {
+		t.Errorf("Vendor WAF should come from 20-vendor.yml, got %+v", sig)
+	}
+	if len(set.Probes) != 1 || set.Probes[0].Path != "/?file=..%2f..%2fetc%2fpasswd" {
+		t.Errorf("probes = %+v, want the traversal probe from 20-vendor.yml", set.Probes)
+	}
+}
+
+func TestLoadMergedSignatureSetErrors(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.yml")
+	if err := os.WriteFile(bad, []byte(`
+signatures:
+  - name: Broken
+    enabled: true
+    indicators:
+      - type: body
+        condition: regex
+        value: "([a-z"
+        confidence: 0.5
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  string
+	}{
+		{"invalid file", []string{bad}, bad + `: signature "Broken" indicator 0: invalid regex`},
+		{"missing path", []string{filepath.Join(dir, "missing.yml")}, "failed to read signatures"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadMergedSignatureSet(tt.paths...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadMergedSignatureSet() error = %v, want %q", err, tt.want)
+			}
+			// Scans must not silently fall back to the embedded signatures
+			if set, err := GetMergedSignatureSet(tt.paths); err == nil || set != nil {
+				t.Errorf("GetMergedSignatureSet() = %v, %v, want the load error", set, err)
+			}
+		})
+	}
+}
+
+func TestGetMergedSignatureSetAllDisabled(t *testing.T) {
+	var overlay strings.Builder
+	overlay.WriteString("signatures:\n")
+	for _, sig := range GetAllSignatures() {
+		fmt.Fprintf(&overlay, "  - name: %q\n    enabled: false\n", sig.Name())
+	}
+	path := filepath.Join(t.TempDir(), "off.yml")
+	if err := os.WriteFile(path, []byte(overlay.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetMergedSignatureSet([]string{path}); err == nil || !strings.Contains(err.Error(), "every signature is disabled") {
+		t.Errorf("GetMergedSignatureSet() error = %v, want every signature disabled", err)
+	}
+}
+
+func TestGetSignatureSetFallback(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.yml")
+	if err := os.WriteFile(empty, []byte("signatures: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := len(GetAllSignatures())
+	for _, path := range []string{empty, filepath.Join(t.TempDir(), "missing.yml")} {
+		if got := len(GetSignatureSet(path).Signatures); got != want {
+			t.Errorf("GetSignatureSet(%q) has %d signatures, want the %d embedded ones", path, got, want)
+		}
+	}
+}
+
+func TestChallengeSignatures(t *testing.T) {
+	set, err := parseSignatureSetFromBytes([]byte(`
+signatures:
+  - name: Example CAPTCHA
+    enabled: true
+    vendor: Example
+    challenge: captcha
+    indicators:
+      - type: body
+        condition: contains
+        value: example-captcha
+        confidence: 0.6
+`))
+	if err != nil {
+		t.Fatalf("parseSignatureSetFromBytes() error = %v", err)
+	}
+	meta := set.Signatures[0].(Describer).Metadata()
+	if meta.Challenge != ChallengeCAPTCHA || meta.Vendor != "Example" {
+		t.Errorf("Metadata() = %+v, want a captcha challenge", meta)
+	}
+
+	_, err = parseSignatureSetFromBytes([]byte(`
+signatures:
+  - name: Example
+    enabled: true
+    challenge: puzzle
+    indicators:
+      - type: body
+        condition: contains
+        value: puzzle
+        confidence: 0.6
+`))
+	if err == nil || !strings.Contains(err.Error(), `signature "Example": unknown challenge type "puzzle"`) {
+		t.Errorf("error = %v, want unknown challenge type", err)
+	}
+}
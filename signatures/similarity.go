@@ -0,0 +1,80 @@
+package signatures
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/ahmedtouahria/waf-detector/scanner"
+)
+
+// Similarity compares two response bodies and returns a score from 0
+// (unrelated) to 1 (identical). It weighs the Jaccard similarity of their
+// word tokens three to one against the ratio of their lengths, so markup
+// shared by pages of the same site keeps the score high while a block page
+// in place of the site scores close to 0.
+func Similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	if a == "" || b == "" {
+		return 0
+	}
+
+	tokensA, tokensB := tokenSet(a), tokenSet(b)
+	shared := 0
+	for token := range tokensA {
+		if tokensB[token] {
+			shared++
+		}
+	}
+	tokens := 1.0
+	if union := len(tokensA) + len(tokensB) - shared; union > 0 {
+		tokens = float64(shared) / float64(union)
+	}
+
+	length := float64(len(a)) / float64(len(b))
+	if length > 1 {
+		length = 1 / length
+	}
+
+	return 0.75*tokens + 0.25*length
+}
+
+// BaselineSimilarity compares the body of probe with the baseline and its
+// samples. The best match is divided by how similar the baseline samples
+// are to each other, so content that changes on every request, such as
+// timestamps or tokens, does not count as divergence. The result is capped
+// at 1.
+func BaselineSimilarity(probe, baseline *scanner.ProbeResult) float64 {
+	bodies := append([]string{baseline.Body}, baseline.Samples...)
+
+	best := 0.0
+	for _, body := range bodies {
+		if s := Similarity(probe.Body, body); s > best {
+			best = s
+		}
+	}
+
+	stability := 1.0
+	for _, sample := range baseline.Samples {
+		if s := Similarity(baseline.Body, sample); s < stability {
+			stability = s
+		}
+	}
+	if stability == 0 || best >= stability {
+		return 1
+	}
+	return best / stability
+}
+
+// tokenSet returns the lower-cased words and numbers in s
+func tokenSet(s string) map[string]bool {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	set := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		set[field] = true
+	}
+	return set
+}
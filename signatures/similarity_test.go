@@ -0,0 +1,59 @@
+package signatures
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ahmedtouahria/waf-detector/scanner"
+)
+
+func TestSimilarity(t *testing.T) {
+	site := `<html><head><title>Example Shop</title></head><body><nav>Home Products Cart</nav><h1>Products</h1><ul><li>Red shoes</li><li>Blue shoes</li></ul><footer>Example Shop Ltd</footer></body></html>`
+	search := strings.Replace(site, "<h1>Products</h1>", "<h1>Search results for 1 OR 1=1</h1>", 1)
+	block := `<html><body><h1>Request blocked</h1><p>Incident ID 7f3a</p></body></html>`
+
+	tests := []struct {
+		name     string
+		a, b     string
+		min, max float64
+	}{
+		{"identical", site, site, 1, 1},
+		{"both empty", "", "", 1, 1},
+		{"one empty", site, "", 0, 0},
+		{"same template", search, site, 0.8, 1},
+		{"block page", block, site, 0, 0.4},
+		{"non-English", "<p>Zugriff verweigert</p>", "<p>Willkommen im Shop</p>", 0, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Similarity(tt.a, tt.b)
+			if got < tt.min || got > tt.max {
+				t.Errorf("Similarity() = %.3f, want %.2f..%.2f", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestBaselineSimilarity(t *testing.T) {
+	// Every request gets a different token and timestamp, so the baseline
+	// samples only partly agree
+	baseline := &scanner.ProbeResult{
+		Body: `<html><p>Welcome</p><input name="csrf" value="a81f"><p>Generated 10:41:07</p></html>`,
+		Samples: []string{
+			`<html><p>Welcome</p><input name="csrf" value="c3e2"><p>Generated 10:41:08</p></html>`,
+		},
+	}
+	same := &scanner.ProbeResult{Body: `<html><p>Welcome</p><input name="csrf" value="09bd"><p>Generated 10:41:09</p></html>`}
+	block := &scanner.ProbeResult{Body: `<html><h1>Access denied</h1></html>`}
+
+	if plain := Similarity(same.Body, baseline.Body); plain >= 0.9 {
+		t.Fatalf("test bodies should differ on their own, Similarity() = %.3f", plain)
+	}
+	if got := BaselineSimilarity(same, baseline); got < 0.9 {
+		t.Errorf("BaselineSimilarity() of dynamic page = %.3f, want at least 0.9", got)
+	}
+	if got := BaselineSimilarity(block, baseline); got >= 0.5 {
+		t.Errorf("BaselineSimilarity() of block page = %.3f, want below 0.5", got)
+	}
+}
@@ -0,0 +1,68 @@
+package signatures
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ahmedtouahria/waf-detector/scanner"
+)
+
+// Fields of the TLS connection a tls indicator's key selects
+const (
+	TLSIssuer  = "issuer"
+	TLSSubject = "subject"
+	TLSSAN     = "san"
+	TLSVersion = "version"
+	TLSALPN    = "alpn"
+	TLSCipher  = "cipher"
+)
+
+// tlsKeys lists the keys of tls indicators in the order errors name them
+var tlsKeys = []string{TLSIssuer, TLSSubject, TLSSAN, TLSVersion, TLSALPN, TLSCipher}
+
+// checkTLSKey reports an unknown or missing tls indicator key
+func checkTLSKey(key string) error {
+	for _, k := range tlsKeys {
+		if strings.EqualFold(key, k) {
+			return nil
+		}
+	}
+	if key == "" {
+		return fmt.Errorf("tls indicators need a key (use %s)", strings.Join(tlsKeys, ", "))
+	}
+	return fmt.Errorf("unknown tls key %q (use %s)", key, strings.Join(tlsKeys, ", "))
+}
+
+// tlsValues returns the values of a TLS field; every SAN is a value of its own
+func tlsValues(info *scanner.TLSInfo, key string) []string {
+	switch strings.ToLower(key) {
+	case TLSIssuer:
+		return []string{info.Issuer}
+	case TLSSubject:
+		return []string{info.Subject}
+	case TLSSAN:
+		return info.SANs
+	case TLSVersion:
+		return []string{info.Version}
+	case TLSALPN:
+		return []string{info.ALPN}
+	case TLSCipher:
+		return []string{info.CipherSuite}
+	}
+	return nil
+}
+
+// matchTLS checks tls indicators against the connection a probe's response
+// arrived on and returns the first value of the field that satisfies the
+// condition. Plain HTTP responses never match.
+func (y *YAMLSignature) matchTLS(indicator Indicator, probe *scanner.ProbeResult) (string, bool) {
+	if probe.TLS == nil {
+		return "", false
+	}
+	for _, value := range tlsValues(probe.TLS, indicator.Key) {
+		if y.matchHeaderValue(indicator, value) {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ahmedtouahria/waf-detector/cli"
+	"github.com/ahmedtouahria/waf-detector/signatures"
+	"github.com/ahmedtouahria/waf-detector/signatures/fixtures"
+)
+
+const sigsUsage = `Usage:
+  waf-detector sigs validate <file>...   Report errors in signature files
+  waf-detector sigs lint <file>...       Also fail on warnings such as disabled signatures
+  waf-detector sigs test [-s path]... [-v] [fixture|dir]...
+                                         Check signatures against recorded responses; -s merges
+                                         files over the embedded signatures, and fixtures default
+                                         to the embedded ones
+`
+
+// runSigs dispatches the sigs subcommands for working with signature files
+func runSigs(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, sigsUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "validate", "lint":
+		os.Exit(lintSignatures(args[0], args[1:]))
+	case "test":
+		os.Exit(testSignatures(args[1:]))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown sigs command %q\n\n%s", args[0], sigsUsage)
+		os.Exit(2)
+	}
+}
+
+// lintSignatures prints file:line:column diagnostics for each file and
+// returns the exit code: 1 when validate finds errors or lint finds anything
+func lintSignatures(command string, args []string) int {
+	fs := flag.NewFlagSet("waf-detector sigs "+command, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, sigsUsage)
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		diagnostics, err := signatures.LintFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+
+		for _, d := range diagnostics {
+			fmt.Printf("%s:%s\n", path, d)
+		}
+		if signatures.HasErrors(diagnostics) || (command == "lint" && len(diagnostics) > 0) {
+			failed = true
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// testSignatures checks signatures against fixtures and returns the exit code:
+// 1 when any fixture fails
+func testSignatures(args []string) int {
+	fs := flag.NewFlagSet("waf-detector sigs test", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, sigsUsage)
+	}
+	var paths cli.StringList
+	fs.Var(&paths, "s", "Signatures file or directory merged over the embedded signatures; repeatable")
+	verbose := fs.Bool("v", false, "Also print passing fixtures")
+	_ = fs.Parse(args)
+
+	sigs := signatures.GetAllSignatures()
+	if len(paths) > 0 {
+		set, err := signatures.LoadMergedSignatureSet(paths...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		sigs = set.Signatures
+	}
+
+	var all []fixtures.Fixture
+	if fs.NArg() == 0 {
+		embedded, err := fixtures.Embedded()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		all = embedded
+	}
+	for _, path := range fs.Args() {
+		loaded, err := fixtures.Load(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		all = append(all, loaded...)
+	}
+
+	failed := 0
+	for _, f := range all {
+		problems := fixtures.Check(sigs, f)
+		if len(problems) == 0 {
+			if *verbose {
+				fmt.Printf("ok    %s (%s)\n", f.Name, f.Path)
+			}
+			continue
+		}
+
+		failed++
+		fmt.Printf("FAIL  %s (%s)\n", f.Name, f.Path)
+		for _, problem := range problems {
+			fmt.Printf("      %s\n", problem)
+		}
+	}
+
+	fmt.Printf("%d fixtures, %d failed\n", len(all), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
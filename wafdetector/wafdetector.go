@@ -0,0 +1,423 @@
+// Package wafdetector is the importable API of waf-detector. It probes
+// targets and fingerprints the WAF/CDN layers in front of them without
+// depending on command-line configuration.
+//
+//	client, err := wafdetector.New(wafdetector.WithTimeout(5 * time.Second))
+//	if err != nil {
+//		return err
+//	}
+//	result, err := client.Detect(ctx, "https://example.com")
+package wafdetector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ahmedtouahria/waf-detector/detector"
+	waferrors "github.com/ahmedtouahria/waf-detector/errors"
+	"github.com/ahmedtouahria/waf-detector/output"
+	"github.com/ahmedtouahria/waf-detector/ratelimit"
+	"github.com/ahmedtouahria/waf-detector/scanner"
+	"github.com/ahmedtouahria/waf-detector/signatures"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultUserAgent   = "waf-detector/1.0"
+	DefaultConcurrency = 10
+)
+
+// Result is the outcome of scanning a single target
+type Result = output.Result
+
+// Layer is a WAF/CDN layer identified in front of a target
+type Layer = output.Layer
+
+// Prober sends the probes for a target. *scanner.Scanner is the default;
+// other implementations can replay recorded probes.
+type Prober interface {
+	Scan(ctx context.Context, target string) (map[scanner.ProbeType]*scanner.ProbeResult, error)
+}
+
+// Recorder saves the probe results of every scanned target
+type Recorder interface {
+	Record(target string, probes map[scanner.ProbeType]*scanner.ProbeResult) error
+}
+
+// Option configures a Client
+type Option func(*options) error
+
+type options struct {
+	scanner       scanner.Options
+	prober        Prober
+	recorder      Recorder
+	signatures    []signatures.Signature
+	probes        []scanner.ProbeDefinition
+	detection     signatures.DetectionPolicy
+	limits        ratelimit.Limits
+	retry         scanner.RetryPolicy
+	concurrency   int
+	minConfidence float64
+}
+
+// WithTransport sends probes through rt instead of the default transport.
+// Proxy settings are ignored when a transport is given.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) error {
+		if rt == nil {
+			return fmt.Errorf("transport must not be nil")
+		}
+		o.scanner.Transport = rt
+		return nil
+	}
+}
+
+// WithProber gets probe results from p instead of scanning, e.g. to replay
+// recorded probes. Transport, proxy, timeout, User-Agent and custom probe
+// options are ignored.
+func WithProber(p Prober) Option {
+	return func(o *options) error {
+		if p == nil {
+			return fmt.Errorf("prober must not be nil")
+		}
+		o.prober = p
+		return nil
+	}
+}
+
+// WithRecorder saves the probe results of every target before detection
+func WithRecorder(r Recorder) Option {
+	return func(o *options) error {
+		if r == nil {
+			return fmt.Errorf("recorder must not be nil")
+		}
+		o.recorder = r
+		return nil
+	}
+}
+
+// WithSignatures replaces the embedded signatures
+func WithSignatures(sigs ...signatures.Signature) Option {
+	return func(o *options) error {
+		if len(sigs) == 0 {
+			return fmt.Errorf("no signatures given")
+		}
+		o.signatures = sigs
+		return nil
+	}
+}
+
+// WithSignatureSet replaces the embedded signatures and registers the custom
+// probes and detection policy declared alongside them
+func WithSignatureSet(set *signatures.SignatureSet) Option {
+	return func(o *options) error {
+		if set == nil || len(set.Signatures) == 0 {
+			return fmt.Errorf("signature set has no signatures")
+		}
+		o.signatures = set.Signatures
+		o.probes = append(o.probes, set.Probes...)
+		if set.Detection.Probes != nil {
+			o.detection = set.Detection
+		}
+		return nil
+	}
+}
+
+// WithDetectionPolicy sets when probe responses count as WAF behavior
+func WithDetectionPolicy(policy signatures.DetectionPolicy) Option {
+	return func(o *options) error {
+		if len(policy.Probes) == 0 {
+			return fmt.Errorf("detection policy has no probes")
+		}
+		if policy.MinBlockedProbes > len(policy.Probes) {
+			return fmt.Errorf("min blocked probes %d is unreachable with %d probes", policy.MinBlockedProbes, len(policy.Probes))
+		}
+		o.detection = policy
+		return nil
+	}
+}
+
+// WithRateLimit throttles probe requests globally and per host. The limits
+// apply across every target the client scans.
+func WithRateLimit(limits ratelimit.Limits) Option {
+	return func(o *options) error {
+		if err := limits.Validate(); err != nil {
+			return err
+		}
+		o.limits = limits
+		return nil
+	}
+}
+
+// WithHTTP2 offers HTTP/2 when connecting over TLS, so tls signature
+// indicators can match the negotiated ALPN. Probes are then sent over
+// HTTP/2 to servers that accept it. Ignored when a transport is given.
+func WithHTTP2(enabled bool) Option {
+	return func(o *options) error {
+		o.scanner.HTTP2 = enabled
+		return nil
+	}
+}
+
+// WithRetry sets how probes that fail with transient errors are retried.
+// The default is scanner.DefaultRetryPolicy; a zero policy disables retries.
+func WithRetry(policy scanner.RetryPolicy) Option {
+	return func(o *options) error {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+		o.retry = policy
+		return nil
+	}
+}
+
+// WithProbes registers custom probes sent after the built-in ones
+func WithProbes(defs ...scanner.ProbeDefinition) Option {
+	return func(o *options) error {
+		o.probes = append(o.probes, defs...)
+		return nil
+	}
+}
+
+// WithLogger receives per-probe debug output
+func WithLogger(log logrus.FieldLogger) Option {
+	return func(o *options) error {
+		o.scanner.Logger = log
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout of each probe request
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout <= 0 {
+			return fmt.Errorf("timeout must be positive, got %v", timeout)
+		}
+		o.scanner.Timeout = timeout
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent sent with every probe
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) error {
+		o.scanner.UserAgent = userAgent
+		return nil
+	}
+}
+
+// WithProxy routes probes through an HTTP proxy
+func WithProxy(proxy string) Option {
+	return func(o *options) error {
+		o.scanner.Proxy = proxy
+		return nil
+	}
+}
+
+// WithConcurrency sets how many targets DetectMany scans at once
+func WithConcurrency(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return fmt.Errorf("concurrency must be at least 1, got %d", n)
+		}
+		o.concurrency = n
+		return nil
+	}
+}
+
+// WithMinConfidence sets the confidence a signature must reach to be
+// reported as a layer
+func WithMinConfidence(minConfidence float64) Option {
+	return func(o *options) error {
+		if minConfidence < 0 || minConfidence > 1 {
+			return fmt.Errorf("min confidence must be between 0 and 1, got %v", minConfidence)
+		}
+		o.minConfidence = minConfidence
+		return nil
+	}
+}
+
+// Client scans targets and fingerprints their WAF/CDN layers. It is safe for
+// concurrent use.
+type Client struct {
+	scanner     Prober
+	recorder    Recorder
+	detector    *detector.Detector
+	concurrency int
+}
+
+// New creates a client. Without options it uses the embedded signatures and
+// the same defaults as the command line.
+func New(opts ...Option) (*Client, error) {
+	o := options{
+		scanner: scanner.Options{
+			Timeout:   DefaultTimeout,
+			UserAgent: DefaultUserAgent,
+		},
+		detection:     signatures.DefaultDetectionPolicy(),
+		retry:         scanner.DefaultRetryPolicy(),
+		concurrency:   DefaultConcurrency,
+		minConfidence: detector.DefaultMinConfidence,
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	prober := o.prober
+	if prober == nil {
+		o.scanner.BaselineSamples = o.detection.BaselineSamples
+		o.scanner.Retry = o.retry
+		if o.limits.Enabled() {
+			limiter, err := ratelimit.New(o.limits)
+			if err != nil {
+				return nil, err
+			}
+			o.scanner.Limiter = limiter
+		}
+		s := scanner.New(o.scanner)
+		if err := s.AddProbes(o.probes...); err != nil {
+			return nil, err
+		}
+		prober = s
+	}
+
+	var d *detector.Detector
+	if len(o.signatures) > 0 {
+		d = detector.NewDetectorWithSignatures(o.signatures)
+	} else {
+		d = detector.NewDetector()
+	}
+	d.SetMinConfidence(o.minConfidence)
+	d.SetPolicy(o.detection)
+
+	return &Client{
+		scanner:     prober,
+		recorder:    o.recorder,
+		detector:    d,
+		concurrency: o.concurrency,
+	}, nil
+}
+
+// Detect scans a single target. When the scan fails the error is returned
+// and also recorded in the result. A target whose normal probe fails is not
+// an error of Detect, but the failure is reported in Result.Error and
+// Result.ErrorType.
+func (c *Client) Detect(ctx context.Context, target string) (Result, error) {
+	start := time.Now()
+
+	probes, err := c.scanner.Scan(ctx, target)
+	if err == nil && c.recorder != nil {
+		if recordErr := c.recorder.Record(target, probes); recordErr != nil {
+			err = fmt.Errorf("failed to record probes: %w", recordErr)
+		}
+	}
+	if err != nil {
+		wafErr := waferrors.Classify(target, err)
+		return Result{
+			URL:       target,
+			WAFFound:  false,
+			Error:     wafErr.Error(),
+			ErrorType: string(wafErr.Type),
+			Transient: wafErr.Transient,
+			ScanTime:  time.Since(start),
+			Timestamp: time.Now(),
+		}, wafErr
+	}
+
+	detection := c.detector.Detect(probes)
+
+	layers := make([]Layer, 0, len(detection.Layers))
+	for _, layer := range detection.Layers {
+		layers = append(layers, Layer{
+			Name:        layer.Name,
+			Vendor:      layer.Vendor,
+			Description: layer.Description,
+			Role:        string(layer.Role),
+			Confidence:  layer.Confidence,
+			Evidence:    layer.Evidence,
+		})
+	}
+
+	var similarity map[string]float64
+	if len(detection.Similarity) > 0 {
+		similarity = make(map[string]float64, len(detection.Similarity))
+		for probe, score := range detection.Similarity {
+			similarity[string(probe)] = math.Round(score*1000) / 1000
+		}
+	}
+
+	// Without a baseline nothing was detected; report why
+	var baselineErr, baselineErrType string
+	var transient bool
+	if normal := probes[scanner.ProbeNormal]; normal != nil && normal.Error != nil {
+		baselineErr = normal.Error.Error()
+		baselineErrType = string(waferrors.TypeOf(normal.Error))
+		transient = waferrors.IsTransient(normal.Error)
+	}
+
+	return Result{
+		URL:        target,
+		WAFFound:   detection.WAFDetected,
+		WAFName:    detection.WAFName,
+		Confidence: detection.Confidence,
+		Details:    detection.Details,
+		Evidence:   detection.Evidence,
+		Layers:     layers,
+		Similarity: similarity,
+		Error:      baselineErr,
+		ErrorType:  baselineErrType,
+		Transient:  transient,
+		ScanTime:   time.Since(start),
+		Timestamp:  time.Now(),
+
+		Challenged:    detection.Challenged,
+		ChallengeType: string(detection.ChallengeType),
+		Challenge:     detection.Challenge,
+	}, nil
+}
+
+// DetectMany scans targets as they arrive, with up to the configured
+// concurrency, and streams results in completion order. Scan errors are
+// reported in Result.Error. The returned channel is closed once targets is
+// closed and drained, or ctx is cancelled.
+func (c *Client) DetectMany(ctx context.Context, targets <-chan string) <-chan Result {
+	results := make(chan Result)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case target, ok := <-targets:
+					if !ok {
+						return
+					}
+					result, _ := c.Detect(ctx, target)
+					select {
+					case results <- result:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
@@ -0,0 +1,162 @@
+package wafdetector
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmedtouahria/waf-detector/ratelimit"
+	"github.com/ahmedtouahria/waf-detector/scanner"
+	"github.com/ahmedtouahria/waf-detector/signatures"
+)
+
+// roundTripFunc serves probes without touching the network
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// cloudflare answers like a site behind Cloudflare that blocks attack probes
+func cloudflare(req *http.Request) (*http.Response, error) {
+	status, body := http.StatusOK, "<html>Welcome</html>"
+	if strings.Contains(req.URL.RawQuery, "OR") || strings.Contains(req.URL.RawQuery, "script") {
+		status, body = http.StatusForbidden, "Attention Required! | Cloudflare"
+	}
+
+	header := http.Header{}
+	header.Set("Server", "cloudflare")
+	header.Set("CF-Ray", "7d1f3a2b9c0e4f21-CDG")
+	header.Add("Set-Cookie", "__cf_bm=abc; path=/")
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestDetect(t *testing.T) {
+	client, err := New(WithTransport(roundTripFunc(cloudflare)))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	result, err := client.Detect(context.Background(), "https://example.com")
+	if err != nil {
+		t.Fatalf("Detect failed: %v", err)
+	}
+	if !result.WAFFound || result.WAFName != "Cloudflare" {
+		t.Errorf("Detect() = %s (found=%v), want Cloudflare", result.WAFName, result.WAFFound)
+	}
+	if len(result.Evidence) == 0 {
+		t.Error("expected evidence for the detection")
+	}
+	if result.Similarity["malformed"] != 1 || result.Similarity["sqli"] >= 0.5 {
+		t.Errorf("Similarity = %v, want malformed at 1 and the sqli block page below 0.5", result.Similarity)
+	}
+}
+
+func TestDetectCancelled(t *testing.T) {
+	client, err := New(WithTransport(roundTripFunc(cloudflare)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := client.Detect(ctx, "https://example.com")
+	if err == nil {
+		t.Fatal("expected error for a cancelled context")
+	}
+	if result.Error == "" || result.URL != "https://example.com" || result.ErrorType != "CANCELED" {
+		t.Errorf("error result = %+v", result)
+	}
+}
+
+func TestDetectBaselineError(t *testing.T) {
+	calls := 0
+	timeout := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return nil, context.DeadlineExceeded
+	})
+	client, err := New(WithTransport(timeout), WithRetry(scanner.RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.Detect(context.Background(), "https://example.com")
+	if err != nil {
+		t.Fatalf("Detect() error = %v", err)
+	}
+	if result.WAFFound || result.ErrorType != "TIMEOUT" || !strings.Contains(result.Error, "[TIMEOUT]") {
+		t.Errorf("result = %+v, want a TIMEOUT error", result)
+	}
+	// Every built-in probe is sent twice
+	if calls != 2*len(scanner.BuiltinProbeTypes()) {
+		t.Errorf("sent %d requests, want each probe retried once", calls)
+	}
+}
+
+func TestDetectMany(t *testing.T) {
+	client, err := New(WithTransport(roundTripFunc(cloudflare)), WithConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"https://a.example", "https://b.example", "https://c.example"}
+	targets := make(chan string)
+	go func() {
+		defer close(targets)
+		for _, target := range want {
+			targets <- target
+		}
+	}()
+
+	var got []string
+	for result := range client.DetectMany(context.Background(), targets) {
+		if result.WAFName != "Cloudflare" {
+			t.Errorf("%s: WAFName = %q", result.URL, result.WAFName)
+		}
+		got = append(got, result.URL)
+	}
+
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("DetectMany() results = %v, want %v", got, want)
+	}
+}
+
+func TestOptionValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"nil transport", WithTransport(nil)},
+		{"nil prober", WithProber(nil)},
+		{"nil recorder", WithRecorder(nil)},
+		{"negative rate", WithRateLimit(ratelimit.Limits{Rate: -1})},
+		{"negative retries", WithRetry(scanner.RetryPolicy{MaxRetries: -1})},
+		{"no signatures", WithSignatures()},
+		{"nil signature set", WithSignatureSet(nil)},
+		{"zero timeout", WithTimeout(0)},
+		{"zero concurrency", WithConcurrency(0)},
+		{"min confidence out of range", WithMinConfidence(1.5)},
+		{"detection policy without probes", WithDetectionPolicy(signatures.DetectionPolicy{})},
+		{"unreachable detection minimum", WithDetectionPolicy(signatures.DetectionPolicy{Probes: []string{"sqli"}, MinBlockedProbes: 2})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.opt); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}